@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+	skyredis "github.com/WiFeng/go-sky/redis"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrNotFound is returned by a loader if the value does not exist, which is
+	// cached for the negative ttl, and returned by GetOrLoad then.
+	ErrNotFound = errors.New("cache value is not found")
+)
+
+// defaultLoadTimeout bounds a load started by a caller without deadline.
+const defaultLoadTimeout = 10 * time.Second
+
+// negativeValue marks the keys whose values do not exist.
+var negativeValue = []byte("\x00sky:cache:not_found")
+
+// Loader loads the value of a missing key, e.g. from the database.
+type Loader func(ctx context.Context) (interface{}, error)
+
+// Option ...
+type Option func(*Cache)
+
+// WithCodec sets the codec of the values, JSON is used if not set.
+func WithCodec(codec Codec) Option {
+	return func(c *Cache) {
+		c.codec = codec
+	}
+}
+
+// WithPrefix sets the prefix of the redis keys, `<name>:` is used if not set.
+func WithPrefix(prefix string) Option {
+	return func(c *Cache) {
+		c.prefix = prefix
+	}
+}
+
+// WithJitter adds a random duration up to ttl*jitter to the ttl of every key,
+// so that the keys set at the same time do not expire together. It's 0.1 by default.
+func WithJitter(jitter float64) Option {
+	return func(c *Cache) {
+		c.jitter = jitter
+	}
+}
+
+// WithNegativeTTL sets how long ErrNotFound of the loader is cached, 0 to disable it. It's 1 minute by default.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithLoadTimeout bounds the loads, which are shared by the callers of a key and
+// not canceled with them. The deadline of the caller starting a load is used if
+// it's not set, or 10 seconds if the caller has no deadline.
+func WithLoadTimeout(d time.Duration) Option {
+	return func(c *Cache) {
+		c.loadTimeout = d
+	}
+}
+
+// WithLocal adds an in-process LRU tier of size entries in front of redis.
+// The entries live for ttl at most, so the processes may see stale values
+// for ttl after a value is changed.
+func WithLocal(size int, ttl time.Duration) Option {
+	return func(c *Cache) {
+		if size > 0 && ttl > 0 {
+			c.local = newLRU(size)
+			c.localTTL = ttl
+		}
+	}
+}
+
+// Cache is a read-through cache on a redis instance. The concurrent loads of
+// the same key in the process are deduplicated.
+type Cache struct {
+	name        string
+	rdb         redis.UniversalClient
+	codec       Codec
+	prefix      string
+	jitter      float64
+	negativeTTL time.Duration
+	loadTimeout time.Duration
+	local       *lru
+	localTTL    time.Duration
+	group       singleflight.Group
+}
+
+// New returns the cache `name` on the redis instance `redisName`.
+func New(ctx context.Context, name string, redisName string, opt ...Option) (*Cache, error) {
+	rdb, err := skyredis.GetUniversalInstance(ctx, redisName)
+	if err != nil {
+		return nil, err
+	}
+	return newCache(name, rdb, opt...), nil
+}
+
+func newCache(name string, rdb redis.UniversalClient, opt ...Option) *Cache {
+	c := &Cache{
+		name:        name,
+		rdb:         rdb,
+		codec:       JSON,
+		prefix:      name + ":",
+		jitter:      0.1,
+		negativeTTL: time.Minute,
+	}
+	for _, f := range opt {
+		f(c)
+	}
+	return c
+}
+
+// GetOrLoad decodes the value of key into dest, which is a pointer. The value is
+// loaded by loader and set with ttl if it's not in the cache.
+func (c *Cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, dest interface{}, loader Loader) error {
+	data, err := c.getOrLoad(ctx, key, ttl, loader)
+	if err != nil {
+		return err
+	}
+	return c.codec.Unmarshal(data, dest)
+}
+
+func (c *Cache) getOrLoad(ctx context.Context, key string, ttl time.Duration, loader Loader) ([]byte, error) {
+	if c.local != nil {
+		if data, ok := c.local.get(key); ok {
+			skyprome.CacheRequestTotalCounter(c.name, "local", "hit")
+			return c.value(data)
+		}
+		skyprome.CacheRequestTotalCounter(c.name, "local", "miss")
+	}
+
+	data, err := c.rdb.Get(ctx, c.prefix+key).Bytes()
+	switch err {
+	case nil:
+		skyprome.CacheRequestTotalCounter(c.name, "redis", "hit")
+		c.addLocal(key, data, ttl)
+		return c.value(data)
+	case redis.Nil:
+		skyprome.CacheRequestTotalCounter(c.name, "redis", "miss")
+	default:
+		// Go on loading the value, redis being down does not break the service.
+		skyprome.CacheRequestTotalCounter(c.name, "redis", "error")
+		log.Warnw(ctx, "cache get error", "name", c.name, "key", key, "err", err)
+	}
+
+	// The load is shared by the callers of the key, so it's not canceled with
+	// the caller starting it, but bounded by the load timeout. A canceled caller
+	// returns without waiting for it.
+	timeout := c.loadTimeout
+	if timeout <= 0 {
+		timeout = defaultLoadTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+	}
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		lctx, cancel := context.WithTimeout(detach(ctx), timeout)
+		defer cancel()
+
+		// A loader ignoring the timeout does not hold the later callers of the key.
+		forget := time.AfterFunc(timeout, func() { c.group.Forget(key) })
+		defer forget.Stop()
+
+		return c.load(lctx, key, ttl, loader)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return c.value(r.Val.([]byte))
+	}
+}
+
+// detachedContext keeps the values of its parent, e.g. the span and the logger,
+// but not the deadline and the cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, loader Loader) (data []byte, err error) {
+	defer func(begin time.Time) {
+		status := "ok"
+		if data != nil && bytes.Equal(data, negativeValue) {
+			status = "not_found"
+		} else if err != nil {
+			status = "error"
+		}
+		skyprome.CacheLoadTotalCounter(c.name, status)
+		skyprome.CacheLoadDurationHistogram(c.name, time.Since(begin).Seconds())
+	}(time.Now())
+
+	v, err := loader(ctx)
+	switch {
+	case errors.Is(err, ErrNotFound) && c.negativeTTL > 0:
+		data, ttl = negativeValue, c.negativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		if data, err = c.codec.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = c.rdb.Set(ctx, c.prefix+key, data, c.withJitter(ttl)).Err(); err != nil {
+		log.Warnw(ctx, "cache set error", "name", c.name, "key", key, "err", err)
+	}
+	c.addLocal(key, data, ttl)
+	return data, nil
+}
+
+// value returns ErrNotFound for the negative value.
+func (c *Cache) value(data []byte) ([]byte, error) {
+	if bytes.Equal(data, negativeValue) {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (c *Cache) withJitter(ttl time.Duration) time.Duration {
+	if c.jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	if n := int64(float64(ttl) * c.jitter); n > 0 {
+		ttl += time.Duration(rand.Int63n(n))
+	}
+	return ttl
+}
+
+func (c *Cache) addLocal(key string, data []byte, ttl time.Duration) {
+	if c.local == nil {
+		return
+	}
+	if ttl <= 0 || ttl > c.localTTL {
+		ttl = c.localTTL
+	}
+	c.local.add(key, data, ttl)
+}
+
+// Set sets the value of key with ttl.
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if err = c.rdb.Set(ctx, c.prefix+key, data, c.withJitter(ttl)).Err(); err != nil {
+		return err
+	}
+	c.addLocal(key, data, ttl)
+	return nil
+}
+
+// Delete deletes key, e.g. after its value is changed. The local tiers of the
+// other processes are not aware of it until their entries expire.
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	if c.local != nil {
+		c.local.remove(key)
+	}
+	return c.rdb.Del(ctx, c.prefix+key).Err()
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/log"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	logConf := config.Log{
+		Level: "info",
+	}
+	if _, err := log.Init(context.Background(), "testService", logConf); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func newTestCache(t *testing.T, opt ...Option) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return newCache("test", rdb, opt...), mr
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2)
+	c.add("a", []byte("1"), time.Minute)
+	c.add("b", []byte("2"), time.Minute)
+
+	if _, ok := c.get("a"); !ok {
+		t.Error("lru.get(a) is missing")
+	}
+
+	// b is the least recently used one.
+	c.add("c", []byte("3"), time.Minute)
+	if _, ok := c.get("b"); ok {
+		t.Error("lru.get(b) is not evicted")
+	}
+	if v, ok := c.get("c"); !ok || string(v) != "3" {
+		t.Errorf("lru.get(c) = %s, %v; want 3, true", v, ok)
+	}
+
+	c.add("d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.get("d"); ok {
+		t.Error("lru.get(d) is not expired")
+	}
+
+	c.remove("a")
+	if _, ok := c.get("a"); ok {
+		t.Error("lru.get(a) is not removed")
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	type user struct {
+		ID   int64
+		Name string
+	}
+
+	for _, codec := range []Codec{JSON, Msgpack} {
+		data, err := codec.Marshal(user{ID: 1, Name: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got user
+		if err = codec.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != 1 || got.Name != "a" {
+			t.Errorf("%T round trip = %+v; want {ID:1 Name:a}", codec, got)
+		}
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	c := &Cache{jitter: 0.1}
+	for i := 0; i < 100; i++ {
+		if got := c.withJitter(time.Second); got < time.Second || got >= 1100*time.Millisecond {
+			t.Fatalf("withJitter = %v; want in [1s, 1.1s)", got)
+		}
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	c, mr := newTestCache(t, WithJitter(0))
+	ctx := context.Background()
+
+	var loads int
+	loader := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return map[string]int{"id": loads}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		var got map[string]int
+		if err := c.GetOrLoad(ctx, "k1", time.Minute, &got, loader); err != nil {
+			t.Fatal(err)
+		}
+		if got["id"] != 1 {
+			t.Errorf("GetOrLoad = %v; want the first load", got)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loader is called %d times; want 1", loads)
+	}
+	if v, _ := mr.Get("test:k1"); v != `{"id":1}` {
+		t.Errorf("redis value = %s", v)
+	}
+	if ttl := mr.TTL("test:k1"); ttl != time.Minute {
+		t.Errorf("redis ttl = %v; want 1m", ttl)
+	}
+
+	// The error of the loader is returned, and nothing is cached.
+	loadErr := errors.New("load failed")
+	var got map[string]int
+	if err := c.GetOrLoad(ctx, "k2", time.Minute, &got, func(ctx context.Context) (interface{}, error) {
+		return nil, loadErr
+	}); err != loadErr {
+		t.Errorf("GetOrLoad = %v; want %v", err, loadErr)
+	}
+	if mr.Exists("test:k2") {
+		t.Error("the failed load is cached")
+	}
+}
+
+func TestGetOrLoadNotFound(t *testing.T) {
+	c, mr := newTestCache(t, WithNegativeTTL(time.Second))
+	ctx := context.Background()
+
+	var loads int
+	loader := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return nil, fmt.Errorf("user 1: %w", ErrNotFound)
+	}
+
+	var got string
+	for i := 0; i < 2; i++ {
+		if err := c.GetOrLoad(ctx, "k1", time.Minute, &got, loader); err != ErrNotFound {
+			t.Errorf("GetOrLoad = %v; want %v", err, ErrNotFound)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loader is called %d times; want 1", loads)
+	}
+	if ttl := mr.TTL("test:k1"); ttl <= 0 || ttl > 1100*time.Millisecond {
+		t.Errorf("negative ttl = %v; want 1s", ttl)
+	}
+
+	// The value is loaded again after the negative ttl.
+	mr.FastForward(2 * time.Second)
+	if err := c.GetOrLoad(ctx, "k1", time.Minute, &got, loader); err != ErrNotFound || loads != 2 {
+		t.Errorf("GetOrLoad = %v, %d loads; want %v, 2 loads", err, loads, ErrNotFound)
+	}
+}
+
+func TestGetOrLoadDedup(t *testing.T) {
+	c, _ := newTestCache(t)
+
+	var loads int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		// The load is not canceled with the caller which starts it.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return "v", nil
+	}
+
+	// The first caller is canceled while the load is in progress.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		var got string
+		first <- c.GetOrLoad(ctx, "k1", time.Minute, &got, loader)
+	}()
+	for atomic.LoadInt32(&loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	values := make([]string, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.GetOrLoad(context.Background(), "k1", time.Minute, &values[i], loader)
+		}(i)
+	}
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("canceled GetOrLoad = %v; want %v", err, context.Canceled)
+	}
+
+	// Let the waiting callers join the load before it finishes.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("loader is called %d times; want 1", n)
+	}
+	for i := range errs {
+		if errs[i] != nil || values[i] != "v" {
+			t.Errorf("GetOrLoad %d = %q, %v; want v", i, values[i], errs[i])
+		}
+	}
+}
+
+func TestGetOrLoadTimeout(t *testing.T) {
+	c, _ := newTestCache(t, WithLoadTimeout(50*time.Millisecond))
+
+	// The load is bounded by the timeout, though the caller has no deadline.
+	var v string
+	err := c.GetOrLoad(context.Background(), "k1", time.Minute, &v, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("GetOrLoad = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	// A loader ignoring the timeout does not hold the key after it.
+	release := make(chan struct{})
+	stale := make(chan struct{})
+	go func() {
+		var v string
+		c.GetOrLoad(context.Background(), "k2", time.Minute, &v, func(ctx context.Context) (interface{}, error) {
+			<-release
+			return "stale", nil
+		})
+		close(stale)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = c.GetOrLoad(ctx, "k2", time.Minute, &v, func(ctx context.Context) (interface{}, error) {
+		return "v", nil
+	}); err != nil || v != "v" {
+		t.Errorf("GetOrLoad after the timeout = %q, %v; want v", v, err)
+	}
+	close(release)
+	<-stale
+}
+
+func TestGetOrLoadCallerDeadline(t *testing.T) {
+	c, _ := newTestCache(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The load started by the caller lasts for the deadline of the caller.
+	loaded := make(chan error, 1)
+	var v string
+	c.GetOrLoad(ctx, "k1", time.Minute, &v, func(lctx context.Context) (interface{}, error) {
+		<-lctx.Done()
+		loaded <- lctx.Err()
+		return nil, lctx.Err()
+	})
+
+	select {
+	case err := <-loaded:
+		if err != context.DeadlineExceeded {
+			t.Errorf("load ctx = %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("load is not bounded by the deadline of the caller")
+	}
+}
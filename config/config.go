@@ -1,7 +1,12 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -35,15 +40,75 @@ func decodeFile(fpath string, v interface{}) (toml.MetaData, error) {
 	return toml.DecodeFile(fpath, v)
 }
 
-// LoadConfig ...
+// validateLayer decodes the file into a new value of the type conf points to.
+func validateLayer(file string, conf interface{}) error {
+	t := reflect.TypeOf(conf)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil
+	}
+	_, err := decodeFile(file, reflect.New(t.Elem()).Interface())
+	return err
+}
+
+// configFiles returns the layers of the config `name` in the directory, in the order
+// they are merged: the base file, the file of the env and the local override file.
+func configFiles(dir string, name string, env string) []string {
+	files := []string{filepath.Join(dir, name+".toml")}
+	if env != "" {
+		files = append(files, filepath.Join(dir, fmt.Sprintf("%s_%s.toml", name, env)))
+	}
+	return append(files, filepath.Join(dir, name+".local.toml"))
+}
+
+// LoadConfig loads the config `name` in the directory, e.g. config.toml, config_<env>.toml
+// and config.local.toml in order. The file of the env is required if env is set, otherwise
+// the base file is required, and the others are optional. The later files override the
+// earlier ones field by field, and the arrays of tables are merged by Name, see mergeTables.
+// Then the ${VAR} and file:// values and the environment variable overrides are resolved,
+// see EnvPrefix. The loaded files are returned, separated by `,`, or the file failed to load.
 func LoadConfig(dir string, name string, env string, conf interface{}) (string, error) {
-	var confFile = fmt.Sprintf("%s/%s.toml", dir, name)
+	var files = configFiles(dir, name, env)
+	var loaded []string
+	var merged = map[string]interface{}{}
 
+	// The file of the env, or the base file without env.
+	var required = files[0]
 	if env != "" {
-		confFile = fmt.Sprintf("./conf/%s_%s.toml", name, env)
+		required = files[1]
+	}
+
+	for _, file := range files {
+		var layer = map[string]interface{}{}
+		if _, err := decodeFile(file, &layer); err != nil {
+			if os.IsNotExist(err) && file != required {
+				continue
+			}
+			return file, err
+		}
+
+		// Every file is decoded into conf alone as well, so that the
+		// errors of the values are reported with the file having them.
+		if err := validateLayer(file, conf); err != nil {
+			return file, err
+		}
+
+		mergeTables(merged, layer)
+		loaded = append(loaded, file)
+	}
+
+	confFile := strings.Join(loaded, ",")
+
+	// The merged tables are decoded by encoding them back, so that conf is
+	// decoded as from a single file.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+		return confFile, err
+	}
+	if _, err := toml.Decode(buf.String(), conf); err != nil {
+		return confFile, err
 	}
 
-	if _, err := decodeFile(confFile, conf); err != nil {
+	if err := resolve(envPrefix(name), conf); err != nil {
 		return confFile, err
 	}
 
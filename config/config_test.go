@@ -0,0 +1,281 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setenv(t *testing.T, kv map[string]string) {
+	t.Helper()
+	for k, v := range kv {
+		os.Setenv(k, v)
+	}
+	t.Cleanup(func() {
+		for k := range kv {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "db_pass"), "s3cret\n")
+	writeFile(t, filepath.Join(dir, "config.toml"), `
+[server]
+name = "${TEST_SKY_SERVICE}"
+
+[server.http]
+addr = ":${TEST_SKY_PORT:-8080}"
+
+[[redis]]
+name = "cache-1"
+host = "127.0.0.1"
+auth = "${TEST_SKY_UNSET:-}"
+
+[[database]]
+name = "db1"
+pass = "file://`+filepath.Join(dir, "db_pass")+`"
+replicaLagQuery = "SELECT '$${not_env}'"
+
+[[database]]
+name = "db2"
+driver = "sqlite3"
+dataSource = "file:///var/lib/app.db?mode=ro"
+
+[[elasticsearch]]
+name = "es1"
+addrs = ["http://localhost:9200"]
+`)
+
+	setenv(t, map[string]string{
+		"TEST_SKY_SERVICE":                   "go.srv.test",
+		"SKY_SERVER_PPROF_ADDR":              ":6060",
+		"SKY_REDIS_CACHE_1_AUTH":             "redis-auth",
+		"SKY_REDIS_0_PORT":                   "6380",
+		"SKY_REDIS_0_SLOWTHRESHOLDMILLSEC":   "20",
+		"SKY_ELASTICSEARCH_ES1_ADDRS":        "http://es1:9200, http://es2:9200",
+		"SKY_ELASTICSEARCH_ES1_DISABLERETRY": "true",
+		"SKY_DATABASE_DB2_PASS":              "not applied",
+	})
+
+	var conf Config
+	if _, err := Init(dir, "", &conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Server.Name != "go.srv.test" || conf.Server.HTTP.Addr != ":8080" || conf.Server.PProf.Addr != ":6060" {
+		t.Errorf("Server = %+v", conf.Server)
+	}
+
+	redis := conf.Redis[0]
+	if redis.Auth != "redis-auth" || redis.Port != 6380 || redis.SlowThresholdMillSec*time.Millisecond != 20*time.Millisecond {
+		t.Errorf("Redis = %+v", redis)
+	}
+
+	if pass := conf.Database[0].Pass; pass != "s3cret" {
+		t.Errorf("Database.Pass = %q; want %q", pass, "s3cret")
+	}
+	if query := conf.Database[0].ReplicaLagQuery; query != "SELECT '${not_env}'" {
+		t.Errorf("Database.ReplicaLagQuery = %q; want the escaped ${", query)
+	}
+	if dsn := conf.Database[1].DataSource; dsn != "file:///var/lib/app.db?mode=ro" {
+		t.Errorf("Database.DataSource = %q; want the file:// DSN kept", dsn)
+	}
+
+	es := conf.Elasticsearch[0]
+	if len(es.Addrs) != 2 || es.Addrs[1] != "http://es2:9200" || !es.DisableRetry {
+		t.Errorf("Elasticsearch = %+v", es)
+	}
+}
+
+func TestLoadConfigEnvError(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.toml"), `
+[[redis]]
+name = "redis1"
+auth = "file://`+filepath.Join(dir, "missing")+`"
+`)
+
+	var conf Config
+	if _, err := Init(dir, "", &conf); err == nil {
+		t.Error("Init with a missing secret file = nil; want an error")
+	}
+
+	writeFile(t, filepath.Join(dir, "config.toml"), `
+[[redis]]
+name = "redis1"
+host = "${TEST_SKY_UNSET}"
+`)
+	if _, err := Init(dir, "", &conf); err == nil {
+		t.Error("Init with an unset env = nil; want an error")
+	}
+
+	writeFile(t, filepath.Join(dir, "config.toml"), `
+[[redis]]
+name = "redis1"
+`)
+	setenv(t, map[string]string{"SKY_REDIS_REDIS1_PORT": "redis"})
+
+	if _, err := Init(dir, "", &conf); err == nil {
+		t.Error("Init with an invalid port = nil; want an error")
+	}
+}
+
+func TestLoadConfigAppEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.toml"), `
+token = "${TEST_SKY_TOKEN:-default}"
+limit = 10
+`)
+	setenv(t, map[string]string{"SKY_APP_LIMIT": "20", "SKY_LIMIT": "30"})
+
+	var app struct {
+		Token string
+		Limit int
+	}
+	if _, err := LoadConfig(dir, "app", "", &app); err != nil {
+		t.Fatal(err)
+	}
+	if app.Token != "default" || app.Limit != 20 {
+		t.Errorf("app = %+v", app)
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.toml"), `
+[server]
+name = "go.srv.demo"
+
+[server.http]
+addr = ":8080"
+
+[server.log]
+level = "debug"
+
+[[database]]
+name = "db1"
+host = "127.0.0.1"
+user = "root"
+pass = "123456"
+  [[database.replicas]]
+  host = "10.0.0.1"
+  [[database.replicas]]
+  host = "10.0.0.2"
+
+[[database]]
+name = "db2"
+host = "127.0.0.1"
+`)
+	writeFile(t, filepath.Join(dir, "config_production.toml"), `
+[server.http]
+addr = ":80"
+
+[[database]]
+Name = "db1"
+host = "db1.internal"
+  [[database.replicas]]
+  host = "db1-replica.internal"
+
+[[database]]
+name = "db3"
+host = "db3.internal"
+`)
+	writeFile(t, filepath.Join(dir, "config.local.toml"), `
+[server.log]
+level = "info"
+`)
+
+	var conf Config
+	confFile, err := Init(dir, "production", &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "config.toml") + "," + filepath.Join(dir, "config_production.toml") + "," +
+		filepath.Join(dir, "config.local.toml"); confFile != want {
+		t.Errorf("Init = %s; want %s", confFile, want)
+	}
+
+	if conf.Server.Name != "go.srv.demo" || conf.Server.HTTP.Addr != ":80" || conf.Server.Log.Level != "info" {
+		t.Errorf("Server = %+v", conf.Server)
+	}
+
+	if len(conf.Database) != 3 {
+		t.Fatalf("Database = %+v", conf.Database)
+	}
+	db1 := conf.Database[0]
+	if db1.Host != "db1.internal" || db1.User != "root" || db1.Pass != "123456" ||
+		len(db1.Replicas) != 1 || db1.Replicas[0].Host != "db1-replica.internal" {
+		t.Errorf("Database db1 = %+v", db1)
+	}
+	if conf.Database[1].Name != "db2" || conf.Database[2].Name != "db3" || conf.Database[2].Host != "db3.internal" {
+		t.Errorf("Database = %+v", conf.Database)
+	}
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config_testing.toml"), `
+[server]
+name = "go.srv.testing"
+`)
+
+	var conf Config
+	if _, err := Init(dir, "testing", &conf); err != nil || conf.Server.Name != "go.srv.testing" {
+		t.Errorf("Init without the base file = %+v, %v", conf.Server, err)
+	}
+
+	if _, err := Init(dir, "", &conf); !os.IsNotExist(err) {
+		t.Errorf("Init without any file = %v; want not exist", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "config.local.toml"), `
+[server]
+name = "go.srv.local"
+`)
+	if _, err := Init(dir, "", &conf); !os.IsNotExist(err) {
+		t.Errorf("Init with the local file only = %v; want not exist", err)
+	}
+
+	// The file of the env is required, even if the base file exists.
+	writeFile(t, filepath.Join(dir, "config.toml"), `
+[server]
+name = "go.srv"
+`)
+	if confFile, err := Init(dir, "production", &conf); !os.IsNotExist(err) || confFile != filepath.Join(dir, "config_production.toml") {
+		t.Errorf("Init without the env file = %s, %v; want not exist", confFile, err)
+	}
+
+	// The error of a value is reported with the file having it.
+	writeFile(t, filepath.Join(dir, "config_production.toml"), `
+[server.http]
+addr = 80
+`)
+	if confFile, err := Init(dir, "production", &conf); err == nil || confFile != filepath.Join(dir, "config_production.toml") {
+		t.Errorf("Init with the invalid env file = %s, %v; want the error of config_production.toml", confFile, err)
+	}
+}
+
+func TestLoadConfigDemo(t *testing.T) {
+	var want, conf Config
+	if _, err := decodeFile("config.toml", &want); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(".", "", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("Init = %+v; want %+v", conf, want)
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Database config ...
 type Database struct {
 	Name              string
@@ -12,4 +14,29 @@ type Database struct {
 	DB                string
 	Charset           string
 	InterpolateParams string
+	SSLMode           string
+
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeMillSec time.Duration
+	ConnMaxIdleTimeMillSec time.Duration
+
+	SlowThresholdMillSec time.Duration
+
+	TxMaxAttempts         int
+	TxRetryBackoffMillSec time.Duration
+
+	Replicas                    []DatabaseReplica
+	ReplicaMaxLagMillSec        time.Duration
+	ReplicaCheckIntervalMillSec time.Duration
+	ReplicaLagQuery             string
+}
+
+// DatabaseReplica config, the empty fields are inherited from the primary ...
+type DatabaseReplica struct {
+	DataSource string
+	Host       string
+	Port       int
+	User       string
+	Pass       string
 }
@@ -1,11 +1,34 @@
 package config
 
+import "time"
+
 // Elasticsearch ...
 type Elasticsearch struct {
-	Name           string
-	Addrs          []string
-	Username       string
-	Password       string
+	Name     string
+	Addrs    []string
+	Username string
+	Password string
+
+	// CloudID is the endpoint of Elastic Cloud, which excludes Addrs.
+	// APIKey is the base64-encoded api key, which excludes Username and Password.
+	CloudID string
+	APIKey  string
+
+	TLSCAFile     string
+	TLSSkipVerify bool
+
+	RetryOnStatus        []int // 502, 503 and 504 by default
+	DisableRetry         bool
+	EnableRetryOnTimeout bool
+	MaxRetries           int // 3 by default
+	RetryBackoffMillSec  time.Duration
+
+	DiscoverNodesOnStart     bool
+	DiscoverNodesIntervalSec time.Duration
+
+	CompressRequestBody bool
+
+	// CustomTranport applies the Transport settings, as Transport.Customized does.
 	CustomTranport bool
 	Transport      HTTPTransport
 }
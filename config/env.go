@@ -0,0 +1,309 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvPrefix is the prefix of the environment variables overriding the config, e.g.
+	// SKY_SERVER_HTTP_ADDR sets Server.HTTP.Addr, and SKY_DATABASE_DB1_PASS sets Pass
+	// of the Database named db1. The elements of the arrays are matched by Name, where
+	// `-` and `.` are replaced by `_`, or by index, e.g. SKY_REDIS_0_AUTH.
+	// The config files except config.toml are overridden by SKY_<NAME>_, e.g. SKY_APP_.
+	EnvPrefix = "SKY_"
+
+	// SecretFilePrefix is the prefix of the credential values read from a file, e.g.
+	// a secret mounted by Kubernetes, the trailing newlines of the file are trimmed.
+	// Only the fields named as the credentials, see secretFields, are read, so that
+	// the other values, e.g. a file:// DSN of SQLite, are kept as they are.
+	SecretFilePrefix = "file://"
+)
+
+// envVarRegexp matches ${VAR} and ${VAR:-default} at the beginning.
+var envVarRegexp = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// secretFields are the names of the credential fields whose file:// values are read.
+var secretFields = map[string]bool{
+	"Pass":             true,
+	"Auth":             true,
+	"Password":         true,
+	"APIKey":           true,
+	"SentinelPassword": true,
+}
+
+// resolve resolves the decoded config before it's used: the ${VAR} in the string
+// values are expanded, then the fields are overridden by the environment variables
+// with the prefix, then the file:// values of the credential fields are read from the files.
+func resolve(prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil
+	}
+
+	if err := walkStrings(rv.Elem(), expandEnv); err != nil {
+		return err
+	}
+
+	for _, kv := range os.Environ() {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv[:i], prefix) {
+			continue
+		}
+		if err := override(rv.Elem(), kv[len(prefix):i], kv[i+1:]); err != nil {
+			return fmt.Errorf("config env %s: %w", kv[:i], err)
+		}
+	}
+
+	return walkSecrets(rv.Elem())
+}
+
+func envPrefix(name string) string {
+	if name == "config" {
+		return EnvPrefix
+	}
+	return EnvPrefix + normalizeEnvName(name) + "_"
+}
+
+func normalizeEnvName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// expandEnv replaces ${VAR} by the environment variable, which must be set, and
+// ${VAR:-default} by the default if the variable is unset or empty. $${ is the
+// escape of a literal ${.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+
+		sub := envVarRegexp.FindStringSubmatch(s[i:])
+		if sub == nil {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		val, ok := os.LookupEnv(sub[1])
+		switch {
+		case sub[2] != "" && val == "":
+			val = sub[3]
+		case !ok:
+			return "", fmt.Errorf("config env ${%s} is not set", sub[1])
+		}
+		b.WriteString(val)
+		i += len(sub[0]) - 1
+	}
+	return b.String(), nil
+}
+
+func readSecretFile(s string) (string, error) {
+	if !strings.HasPrefix(s, SecretFilePrefix) {
+		return s, nil
+	}
+	path := strings.TrimPrefix(s, SecretFilePrefix)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("config secret file: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// walkSecrets reads the file:// values of the credential string fields in v,
+// including the ones of the structs in slices and maps.
+func walkSecrets(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return walkSecrets(v.Elem())
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if f.Kind() == reflect.String && secretFields[t.Field(i).Name] {
+				r, err := readSecretFile(f.String())
+				if err != nil {
+					return fmt.Errorf("config %s: %w", t.Field(i).Name, err)
+				}
+				f.SetString(r)
+				continue
+			}
+			if err := walkSecrets(f); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkSecrets(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkStrings replaces the settable string values in v by fn, including the
+// elements of slices and the values of maps.
+func walkStrings(v reflect.Value, fn func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return walkStrings(v.Elem(), fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				if err := walkStrings(f, fn); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, k := range v.MapKeys() {
+			r, err := fn(v.MapIndex(k).String())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(k, reflect.ValueOf(r).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		r, err := fn(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(r)
+	}
+	return nil
+}
+
+// override sets the field of the path, the upper-case field names and the array
+// elements joined by `_`, to the value. The path not matching any field is ignored.
+func override(v reflect.Value, path string, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return override(v.Elem(), path, value)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			name := strings.ToUpper(t.Field(i).Name)
+			if path == name {
+				return setValue(f, value)
+			}
+			if strings.HasPrefix(path, name+"_") {
+				if err := override(f, path[len(name)+1:], value); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			for _, key := range elementKeys(elem, i) {
+				if strings.HasPrefix(path, key+"_") {
+					if err := override(elem, path[len(key)+1:], value); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// elementKeys returns the keys of the array element in the path, its Name and index.
+func elementKeys(elem reflect.Value, i int) []string {
+	keys := []string{strconv.Itoa(i)}
+	if name := elem.FieldByName("Name"); name.IsValid() && name.Kind() == reflect.String && name.String() != "" {
+		keys = append(keys, normalizeEnvName(name.String()))
+	}
+	return keys
+}
+
+// setValue parses the value as the toml value of the field, e.g. the durations are
+// numbers of the unit in the field name, and the elements of slices are separated by `,`.
+func setValue(f reflect.Value, value string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		if value == "" {
+			f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+			return nil
+		}
+		parts := strings.Split(value, ",")
+		s := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(s.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ package config
 type Kafka struct {
 	Name         string
 	Addrs        []string
+	Version      string
 	CustomConfig bool
 	Producer     KafkaProducer
 	Consumer     KafkaConsumer
@@ -12,6 +13,20 @@ type Kafka struct {
 // KafkaConsumer ...
 type KafkaConsumer struct {
 	GroupID string
+	Retry   KafkaRetry
+}
+
+// KafkaRetry ...
+type KafkaRetry struct {
+	Attempts          int
+	BackoffMillSec    int
+	MaxBackoffMillSec int
+
+	Topics            int
+	TopicDelayMillSec int
+	TopicSuffix       string
+	DeadLetterSuffix  string
+	DisableDeadLetter bool
 }
 
 // KafkaProducer ...
@@ -0,0 +1,85 @@
+package config
+
+import "strings"
+
+// mergeTables merges the decoded toml tables of src into dst. The keys are matched
+// case-insensitively, as they are decoded into the fields. The tables are merged
+// recursively, and the arrays of tables by the `name` of the tables, e.g. the
+// [[database]] named db1 of src overrides the fields of the one of dst, and the
+// ones not in dst are appended. The other values of src replace the ones of dst,
+// including the arrays of tables without names.
+func mergeTables(dst map[string]interface{}, src map[string]interface{}) {
+	for key, sv := range src {
+		dkey, dv, ok := lookupKey(dst, key)
+		if !ok {
+			dst[key] = sv
+			continue
+		}
+
+		switch s := sv.(type) {
+		case map[string]interface{}:
+			if d, ok := dv.(map[string]interface{}); ok {
+				mergeTables(d, s)
+				continue
+			}
+		case []map[string]interface{}:
+			if d, ok := dv.([]map[string]interface{}); ok {
+				if merged, ok := mergeTableArrays(d, s); ok {
+					dst[dkey] = merged
+					continue
+				}
+			}
+		}
+		dst[dkey] = sv
+	}
+}
+
+// mergeTableArrays merges the arrays of tables by name, it returns false if
+// any of the tables has no name.
+func mergeTableArrays(dst []map[string]interface{}, src []map[string]interface{}) ([]map[string]interface{}, bool) {
+	index := make(map[string]int, len(dst))
+	for i, d := range dst {
+		name, ok := tableName(d)
+		if !ok {
+			return nil, false
+		}
+		index[name] = i
+	}
+	for _, s := range src {
+		if _, ok := tableName(s); !ok {
+			return nil, false
+		}
+	}
+
+	for _, s := range src {
+		name, _ := tableName(s)
+		if i, ok := index[name]; ok {
+			mergeTables(dst[i], s)
+			continue
+		}
+		index[name] = len(dst)
+		dst = append(dst, s)
+	}
+	return dst, true
+}
+
+func tableName(t map[string]interface{}) (string, bool) {
+	_, v, ok := lookupKey(t, "name")
+	if !ok {
+		return "", false
+	}
+	name, ok := v.(string)
+	return name, ok
+}
+
+func lookupKey(t map[string]interface{}, key string) (string, interface{}, bool) {
+	if v, ok := t[key]; ok {
+		return key, v, true
+	}
+	for k, v := range t {
+		if strings.EqualFold(k, key) {
+			return k, v, true
+		}
+	}
+	return "", nil, false
+}
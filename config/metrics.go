@@ -9,16 +9,40 @@ type Metrics struct {
 type Prometheus struct {
 	Addr string
 
-	DisableHTTPServerRequestsTotalCounter      bool
-	DisableHTTPServerRequestsDurationHistogram bool
-	DisableHTTPServerRequestsDurationSummary   bool
-	DisableHTTPClientRequestsTotalCounter      bool
-	DisableHTTPClientRequestsDurationHistogram bool
-	DisableHTTPClientRequestsDurationSummary   bool
-	DisableLogTotalCounter                     bool
+	DisableHTTPServerRequestsTotalCounter       bool
+	DisableHTTPServerRequestsDurationHistogram  bool
+	DisableHTTPServerRequestsDurationSummary    bool
+	DisableHTTPClientRequestsTotalCounter       bool
+	DisableHTTPClientRequestsDurationHistogram  bool
+	DisableHTTPClientRequestsDurationSummary    bool
+	DisableLogTotalCounter                      bool
+	DisableKafkaConsumerRetryTotalCounter       bool
+	DisableKafkaConsumerDeadLetterTotalCounter  bool
+	DisableOutboxPendingGauge                   bool
+	DisableOutboxPublishTotalCounter            bool
+	DisableDatabasePoolStats                    bool
+	DisableDBClientRequestsTotalCounter         bool
+	DisableDBClientRequestsDurationHistogram    bool
+	DisableDBClientTxAttemptTotalCounter        bool
+	DisableDBClientTxDurationHistogram          bool
+	DisableRedisPoolStats                       bool
+	DisableRedisClientRequestsTotalCounter      bool
+	DisableRedisClientRequestsDurationHistogram bool
+	DisableCacheRequestTotalCounter             bool
+	DisableCacheLoadTotalCounter                bool
+	DisableCacheLoadDurationHistogram           bool
+	DisableESClientRequestsTotalCounter         bool
+	DisableESClientRequestsDurationHistogram    bool
+	DisableESBulkIndexerStats                   bool
+	DisableESBulkIndexerFlushDurationHistogram  bool
 
 	HTTPServerRequestsDurationHistogramBuckets  []float64
 	HTTPServerRequestsDurationSummaryObjectives map[float64]float64
 	HTTPClientRequestsDurationHistogramBuckets  []float64
 	HTTPClientRequestsDurationSummaryObjectives map[float64]float64
+	DBClientRequestsDurationHistogramBuckets    []float64
+	RedisClientRequestsDurationHistogramBuckets []float64
+	CacheLoadDurationHistogramBuckets           []float64
+	ESClientRequestsDurationHistogramBuckets    []float64
+	ESBulkIndexerFlushDurationHistogramBuckets  []float64
 }
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Redis redis config
 type Redis struct {
 	Name string
@@ -7,4 +9,30 @@ type Redis struct {
 	Port int
 	Auth string
 	DB   int
+
+	// Mode is standalone (default), sentinel or cluster. Addrs are the
+	// sentinel or cluster nodes, Host and Port are used if it's empty.
+	Mode             string
+	Addrs            []string
+	MasterName       string
+	SentinelPassword string
+	Username         string
+
+	TLS           bool
+	TLSSkipVerify bool
+	TLSServerName string
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+
+	PoolSize            int
+	MinIdleConns        int
+	MaxRetries          int
+	DialTimeoutMillSec  time.Duration
+	ReadTimeoutMillSec  time.Duration
+	WriteTimeoutMillSec time.Duration
+
+	SlowThresholdMillSec time.Duration
+	TraceMaxArgsLen      int // -1 to disable the arguments tags of spans
+	TraceMaxPipelineCmds int // -1 to tag all of the commands of a pipeline
 }
@@ -4,11 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"time"
 
 	"github.com/WiFeng/go-sky/config"
-	skysql "github.com/WiFeng/go-sky/database/sql"
+	skydriver "github.com/WiFeng/go-sky/database/sql/driver"
 	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
 )
 
 var (
@@ -19,48 +20,71 @@ var (
 var (
 	// ErrConfigNotFound ...
 	ErrConfigNotFound = errors.New("database config is not found")
+	// ErrDSNBuilderNotFound ...
+	ErrDSNBuilderNotFound = errors.New("database dsn builder is not found")
 )
 
 // Init ...
 func Init(ctx context.Context, serviceName string, cfs []config.Database) {
 
 	for _, cf := range cfs {
+		if cf.Driver == "" {
+			cf.Driver = "mysql"
+		}
 		dbConfig[cf.Name] = cf
 
-		var db *sql.DB
-		var err error
-		{
-			if cf.Driver == "" {
-				cf.Driver = "mysql"
-			}
-			if cf.Charset == "" {
-				cf.Charset = "utf8mb4"
-			}
-			if cf.InterpolateParams == "" {
-				cf.InterpolateParams = "true"
-			}
-			if cf.DataSource == "" {
-				cf.DataSource = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&interpolateParams=%s", cf.User, cf.Pass, cf.Host, cf.Port, cf.DB, cf.Charset, cf.InterpolateParams)
-			}
-
-			driverName := skysql.Register(cf.Driver)
-			if db, err = sql.Open(driverName, cf.DataSource); err != nil {
-				log.Fatalw(ctx, "database open error", "conf", cf, "err", err)
-				continue
-			}
-			if err = db.PingContext(ctx); err != nil {
-				log.Fatalw(ctx, "database ping error", "conf", cf, "err", err)
-				continue
-			}
+		db, err := open(ctx, cf.Name, cf)
+		if err != nil {
+			log.Fatalw(ctx, "database open error", "name", cf.Name, "driver", cf.Driver, "err", err)
+			continue
 		}
 
 		// Dont show passwd in log
-		cf.Pass = "dont show me!"
-		log.Infof(ctx, "Init database [%s] %+v", cf.Name, cf)
+		logCf := cf
+		logCf.Pass = "dont show me!"
+		logCf.Replicas = nil
+		log.Infof(ctx, "Init database [%s] %+v", cf.Name, logCf)
 		dbMap[cf.Name] = db
+		skyprome.RegisterDatabaseStats(cf.Name, db.Stats)
+
+		clusterMap[cf.Name] = newCluster(ctx, cf, db)
 	}
 }
 
+// open opens and pings the database of cf, instance is the name used in metrics and logs.
+func open(ctx context.Context, instance string, cf config.Database) (*sql.DB, error) {
+	dsn, err := buildDSN(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(skydriver.NewConnector(skydriver.Driver{
+		BaseName:      cf.Driver,
+		Instance:      instance,
+		SlowThreshold: cf.SlowThresholdMillSec * time.Millisecond,
+	}, dsn))
+
+	// A zero value keeps the default of database/sql. MaxIdleConns
+	// is set first, SetMaxOpenConns lowers it when it's larger.
+	if cf.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cf.MaxIdleConns)
+	}
+	if cf.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cf.MaxOpenConns)
+	}
+	if cf.ConnMaxLifetimeMillSec > 0 {
+		db.SetConnMaxLifetime(cf.ConnMaxLifetimeMillSec * time.Millisecond)
+	}
+	if cf.ConnMaxIdleTimeMillSec > 0 {
+		db.SetConnMaxIdleTime(cf.ConnMaxIdleTimeMillSec * time.Millisecond)
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		return db, err
+	}
+	return db, nil
+}
+
 // GetInstance ...
 func GetInstance(ctx context.Context, instanceName string) (*sql.DB, error) {
 	db, ok := dbMap[instanceName]
@@ -71,3 +95,14 @@ func GetInstance(ctx context.Context, instanceName string) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+// GetConfig ...
+func GetConfig(ctx context.Context, instanceName string) (config.Database, error) {
+	cf, ok := dbConfig[instanceName]
+	if !ok {
+		err := ErrConfigNotFound
+		log.Errorw(ctx, "database.GetConfig, instanceName is not in dbConfig map", "instance_name", instanceName, "err", err)
+		return cf, err
+	}
+	return cf, nil
+}
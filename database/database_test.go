@@ -2,19 +2,30 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/WiFeng/go-sky/config"
 	"github.com/WiFeng/go-sky/log"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
 	testName    = "db1"
+	testSQLite  = "sqlite1"
 	testService = "testService"
+	testAddr    = "127.0.0.1:3306"
+
+	// testMySQL is whether the mysql of testAddr is available. The tests of
+	// it are skipped without it, the others use sqlite.
+	testMySQL bool
 )
 
 func TestMain(m *testing.M) {
@@ -36,12 +47,42 @@ func TestMain(m *testing.M) {
 		fmt.Println("Error:", err)
 	}
 
-	Init(context.Background(), testService, dbConf)
+	dir, err := os.MkdirTemp("", "database_test")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	Init(context.Background(), testService, []config.Database{
+		{
+			Name:                  testSQLite,
+			Driver:                "sqlite3",
+			DB:                    filepath.Join(dir, "test.db"),
+			TxRetryBackoffMillSec: 1,
+		},
+	})
+
+	if conn, err := net.DialTimeout("tcp", testAddr, time.Second); err != nil {
+		fmt.Println("Skip the tests of the mysql:", err)
+	} else {
+		conn.Close()
+		testMySQL = true
+		Init(context.Background(), testService, dbConf)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
 
-	os.Exit(m.Run())
+func skipWithoutMySQL(t *testing.T) {
+	t.Helper()
+	if !testMySQL {
+		t.Skip("mysql " + testAddr + " is not available")
+	}
 }
 
 func TestSelect(t *testing.T) {
+	skipWithoutMySQL(t)
 	var ctx = context.Background()
 	db, err := GetInstance(ctx, testName)
 	if err != nil {
@@ -62,6 +103,7 @@ func TestSelect(t *testing.T) {
 }
 
 func TestStmtQueryContext(t *testing.T) {
+	skipWithoutMySQL(t)
 	var ctx = context.Background()
 	db, err := GetInstance(ctx, testName)
 	if err != nil {
@@ -89,6 +131,7 @@ func TestStmtQueryContext(t *testing.T) {
 }
 
 func TestStmtInsertContext(t *testing.T) {
+	skipWithoutMySQL(t)
 	var ctx = context.Background()
 	db, err := GetInstance(ctx, testName)
 	if err != nil {
@@ -108,3 +151,38 @@ func TestStmtInsertContext(t *testing.T) {
 		return
 	}
 }
+
+func TestReplicaReader(t *testing.T) {
+	var ctx = context.Background()
+	primary, _ := sql.Open("mysql", "")
+	r1, _ := sql.Open("mysql", "")
+	r2, _ := sql.Open("mysql", "")
+
+	db := &DB{
+		primary: primary,
+		replicas: []*replica{
+			{instance: "r1", db: r1, healthy: 1},
+			{instance: "r2", db: r2, healthy: 1},
+		},
+	}
+
+	if got1, got2 := db.Reader(ctx), db.Reader(ctx); got1 == got2 || got1 == primary || got2 == primary {
+		t.Error("db.Reader does not round robin the healthy replicas")
+	}
+
+	if got := db.Reader(WithPrimary(ctx)); got != primary {
+		t.Error("db.Reader(WithPrimary) is not the primary")
+	}
+
+	db.replicas[0].healthy = 0
+	for i := 0; i < 3; i++ {
+		if got := db.Reader(ctx); got != r2 {
+			t.Error("db.Reader is not the healthy replica")
+		}
+	}
+
+	db.replicas[1].healthy = 0
+	if got := db.Reader(ctx); got != primary {
+		t.Error("db.Reader is not the primary when no replica is healthy")
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/WiFeng/go-sky/config"
+)
+
+// DSNBuilder builds the data source name of a driver from config.
+type DSNBuilder func(cf config.Database) string
+
+var (
+	dsnBuilderMu  sync.RWMutex
+	dsnBuilderMap = map[string]DSNBuilder{
+		"mysql":      mysqlDSN,
+		"postgres":   postgresDSN,
+		"pgx":        postgresDSN,
+		"sqlite3":    sqliteDSN,
+		"sqlite":     sqliteDSN,
+		"clickhouse": clickhouseDSN,
+	}
+)
+
+// RegisterDSNBuilder registers the DSNBuilder of driverName, which is used when DataSource is not configured.
+func RegisterDSNBuilder(driverName string, builder DSNBuilder) {
+	dsnBuilderMu.Lock()
+	defer dsnBuilderMu.Unlock()
+	dsnBuilderMap[driverName] = builder
+}
+
+func buildDSN(cf config.Database) (string, error) {
+	if cf.DataSource != "" {
+		return cf.DataSource, nil
+	}
+
+	dsnBuilderMu.RLock()
+	builder, ok := dsnBuilderMap[cf.Driver]
+	dsnBuilderMu.RUnlock()
+	if !ok {
+		return "", ErrDSNBuilderNotFound
+	}
+	return builder(cf), nil
+}
+
+func mysqlDSN(cf config.Database) string {
+	charset := cf.Charset
+	if charset == "" {
+		charset = "utf8mb4"
+	}
+	interpolateParams := cf.InterpolateParams
+	if interpolateParams == "" {
+		interpolateParams = "true"
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&interpolateParams=%s", cf.User, cf.Pass, cf.Host, cf.Port, cf.DB, charset, interpolateParams)
+}
+
+func postgresDSN(cf config.Database) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cf.User, cf.Pass),
+		Host:   fmt.Sprintf("%s:%d", cf.Host, cf.Port),
+		Path:   "/" + cf.DB,
+	}
+	if cf.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {cf.SSLMode}}.Encode()
+	}
+	return u.String()
+}
+
+func sqliteDSN(cf config.Database) string {
+	return cf.DB
+}
+
+func clickhouseDSN(cf config.Database) string {
+	u := url.URL{
+		Scheme: "clickhouse",
+		User:   url.UserPassword(cf.User, cf.Pass),
+		Host:   fmt.Sprintf("%s:%d", cf.Host, cf.Port),
+		Path:   "/" + cf.DB,
+	}
+	return u.String()
+}
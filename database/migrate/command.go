@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const (
+	// CommandName is the subcommand handled by RunCommand.
+	CommandName = "migrate"
+)
+
+var (
+	// ErrUnknownCommand ...
+	ErrUnknownCommand = errors.New("unknown migrate command")
+)
+
+// RunCommand runs `migrate up|down [steps]|force <version>|status` if it's the
+// subcommand in args, e.g. the args remaining after the flags of the service:
+//
+//	if ok, err := migrate.RunCommand(ctx, sky.Args(), "db1", migrations); ok {
+//		if err != nil {
+//			os.Exit(1)
+//		}
+//		os.Exit(0)
+//	}
+//
+// It reports whether args is a migrate command.
+func RunCommand(ctx context.Context, args []string, dbName string, fsys fs.FS, opt ...Option) (bool, error) {
+	if len(args) == 0 || args[0] != CommandName {
+		return false, nil
+	}
+	return true, runCommand(ctx, os.Stdout, args[1:], dbName, fsys, opt...)
+}
+
+func runCommand(ctx context.Context, w io.Writer, args []string, dbName string, fsys fs.FS, opt ...Option) error {
+	if len(args) == 0 {
+		args = []string{"status"}
+	}
+
+	m, err := New(ctx, dbName, fsys, opt...)
+	if err != nil {
+		fmt.Fprintf(w, "migrate error: %v\n", err)
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		var n int
+		if n, err = m.Up(ctx); err == nil {
+			fmt.Fprintf(w, "%d migrations applied\n", n)
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				break
+			}
+		}
+
+		var n int
+		if n, err = m.Down(ctx, steps); err == nil {
+			fmt.Fprintf(w, "%d migrations reverted\n", n)
+		}
+
+	case "force":
+		if len(args) < 2 {
+			err = ErrVersionNotFound
+			break
+		}
+
+		var version int64
+		if version, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			break
+		}
+		if err = m.Force(ctx, version); err == nil {
+			fmt.Fprintf(w, "version forced to %d\n", version)
+		}
+
+	case "status":
+		var status []Status
+		if status, err = m.Status(ctx); err != nil {
+			break
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+		fmt.Fprintf(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT\n")
+		for _, s := range status {
+			state := "pending"
+			if s.Dirty {
+				state = "dirty"
+			} else if s.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, s.AppliedAt)
+		}
+		tw.Flush()
+
+	default:
+		err = ErrUnknownCommand
+	}
+
+	if err != nil {
+		fmt.Fprintf(w, "migrate %s error: %v\n", args[0], err)
+	}
+	return err
+}
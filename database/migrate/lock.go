@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+)
+
+var (
+	// ErrLockTimeout ...
+	ErrLockTimeout = errors.New("migrate lock timeout")
+)
+
+// lock takes the migration lock of the schema table on conn. MySQL and PostgreSQL
+// use session level advisory locks, which are released by the server if the process
+// dies. No lock is taken for the other drivers.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	name := "sky_migrate." + m.schema + "." + m.opts.table
+
+	switch m.driver {
+	case "mysql":
+		// The lock name is limited to 64 characters.
+		if len(name) > 64 {
+			name = name[:64]
+		}
+
+		var got sql.NullInt64
+		seconds := int64(m.opts.lockTimeout / time.Second)
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, seconds).Scan(&got); err != nil {
+			return nil, err
+		}
+		if got.Int64 != 1 {
+			return nil, ErrLockTimeout
+		}
+
+		return func() {
+			if _, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", name); err != nil {
+				log.Warnw(ctx, "migrate unlock error", "db_name", m.dbName, "lock", name, "err", err)
+			}
+		}, nil
+
+	case "postgres", "pgx":
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		key := int64(h.Sum64())
+
+		lctx, cancel := context.WithTimeout(ctx, m.opts.lockTimeout)
+		defer cancel()
+		if _, err := conn.ExecContext(lctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+			if lctx.Err() == context.DeadlineExceeded {
+				return nil, ErrLockTimeout
+			}
+			return nil, err
+		}
+
+		return func() {
+			if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+				log.Warnw(ctx, "migrate unlock error", "db_name", m.dbName, "lock", name, "err", err)
+			}
+		}, nil
+	}
+
+	return func() {}, nil
+}
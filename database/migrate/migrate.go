@@ -0,0 +1,393 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WiFeng/go-sky/database"
+	"github.com/WiFeng/go-sky/log"
+)
+
+const (
+	// DefaultTable ...
+	DefaultTable = "sky_schema_migrations"
+)
+
+var (
+	// ErrDirty ...
+	ErrDirty = errors.New("database schema is dirty, fix it by hand and force the version")
+	// ErrMissingDown ...
+	ErrMissingDown = errors.New("migration has no down sql")
+	// ErrVersionNotFound ...
+	ErrVersionNotFound = errors.New("migration version is not found")
+)
+
+// Option ...
+type Option func(*options)
+
+type options struct {
+	table       string
+	lockTimeout time.Duration
+}
+
+// WithTable sets the table which tracks the applied versions, DefaultTable is used if not set.
+func WithTable(table string) Option {
+	return func(o *options) {
+		o.table = table
+	}
+}
+
+// WithLockTimeout sets how long to wait for the migrations running on other processes.
+func WithLockTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = d
+	}
+}
+
+// Status ...
+type Status struct {
+	Migration
+	Applied   bool
+	Dirty     bool
+	AppliedAt string
+}
+
+// Migrator applies migrations to a database instance. The versions applied are
+// tracked in a schema table, and a lock held during every operation keeps the
+// processes starting at the same time from racing.
+type Migrator struct {
+	dbName     string
+	driver     string
+	schema     string
+	db         *sql.DB
+	migrations []Migration
+	opts       options
+}
+
+// New loads the migrations from fsys for the database instance `dbName`, see Load.
+func New(ctx context.Context, dbName string, fsys fs.FS, opt ...Option) (*Migrator, error) {
+	db, err := database.GetInstance(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := database.GetConfig(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		log.Errorw(ctx, "migrate.New, load migrations error", "db_name", dbName, "err", err)
+		return nil, err
+	}
+
+	o := options{
+		table:       DefaultTable,
+		lockTimeout: time.Minute,
+	}
+	for _, f := range opt {
+		f(&o)
+	}
+
+	m := &Migrator{
+		dbName:     dbName,
+		driver:     cf.Driver,
+		schema:     cf.DB,
+		db:         db,
+		migrations: migrations,
+		opts:       o,
+	}
+	return m, nil
+}
+
+// Up applies all of the pending migrations, and returns how many are applied.
+func Up(ctx context.Context, dbName string, fsys fs.FS, opt ...Option) (int, error) {
+	m, err := New(ctx, dbName, fsys, opt...)
+	if err != nil {
+		return 0, err
+	}
+	return m.Up(ctx)
+}
+
+// Up applies all of the pending migrations, and returns how many are applied.
+func (m *Migrator) Up(ctx context.Context) (n int, err error) {
+	err = m.run(ctx, false, func(conn *sql.Conn, applied map[int64]bool) error {
+		for _, mg := range m.migrations {
+			if applied[mg.Version] {
+				continue
+			}
+			if err := m.apply(ctx, conn, mg, true); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return
+}
+
+// Down reverts the last `steps` applied migrations, and returns how many are reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (n int, err error) {
+	err = m.run(ctx, false, func(conn *sql.Conn, applied map[int64]bool) error {
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mg := m.migrations[i]
+			if !applied[mg.Version] {
+				continue
+			}
+			if err := m.apply(ctx, conn, mg, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return
+}
+
+// Force marks the migrations up to version as applied and the others as not,
+// without running them. It's used to recover from a dirty schema fixed by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	found := version == 0
+	for _, mg := range m.migrations {
+		if mg.Version == version {
+			found = true
+		}
+	}
+	if !found {
+		return ErrVersionNotFound
+	}
+
+	return m.run(ctx, true, func(conn *sql.Conn, applied map[int64]bool) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", m.opts.table)); err != nil {
+			return err
+		}
+
+		insert := m.bind(fmt.Sprintf("INSERT INTO %s (version, name, dirty, applied_at) VALUES (?, ?, FALSE, CURRENT_TIMESTAMP)", m.opts.table))
+		for _, mg := range m.migrations {
+			if mg.Version > version {
+				break
+			}
+			if _, err = tx.ExecContext(ctx, insert, mg.Version, mg.Name); err != nil {
+				return err
+			}
+		}
+
+		log.Warnw(ctx, "migrate force version", "db_name", m.dbName, "version", version)
+		return tx.Commit()
+	})
+}
+
+// Status returns the state of every migration, sorted by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var status []Status
+	err := m.run(ctx, true, func(conn *sql.Conn, applied map[int64]bool) error {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, dirty, applied_at FROM %s", m.opts.table))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		type row struct {
+			dirty     bool
+			appliedAt sql.NullString
+		}
+		rs := map[int64]row{}
+		for rows.Next() {
+			var version int64
+			var r row
+			if err = rows.Scan(&version, &r.dirty, &r.appliedAt); err != nil {
+				return err
+			}
+			rs[version] = r
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			r, ok := rs[mg.Version]
+			status = append(status, Status{
+				Migration: mg,
+				Applied:   ok,
+				Dirty:     r.dirty,
+				AppliedAt: r.appliedAt.String,
+			})
+		}
+		return nil
+	})
+	return status, err
+}
+
+// run calls f with a connection holding the migration lock and the applied versions.
+// A dirty schema is reported as ErrDirty unless ignoreDirty is true.
+func (m *Migrator) run(ctx context.Context, ignoreDirty bool, f func(conn *sql.Conn, applied map[int64]bool) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		log.Errorw(ctx, "migrate lock error", "db_name", m.dbName, "table", m.opts.table, "err", err)
+		return err
+	}
+	defer unlock()
+
+	if err = m.createTable(ctx, conn); err != nil {
+		log.Errorw(ctx, "migrate create table error", "db_name", m.dbName, "table", m.opts.table, "err", err)
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, dirty FROM %s", m.opts.table))
+	if err != nil {
+		return err
+	}
+
+	applied := map[int64]bool{}
+	var dirty []int64
+	for rows.Next() {
+		var version int64
+		var isDirty bool
+		if err = rows.Scan(&version, &isDirty); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+		if isDirty {
+			dirty = append(dirty, version)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(dirty) > 0 && !ignoreDirty {
+		log.Errorw(ctx, "migrate dirty schema", "db_name", m.dbName, "table", m.opts.table, "versions", dirty)
+		return ErrDirty
+	}
+
+	return f(conn, applied)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  version BIGINT NOT NULL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  dirty BOOLEAN NOT NULL DEFAULT FALSE,
+  applied_at TIMESTAMP NULL
+)`, m.opts.table)
+	_, err := conn.ExecContext(ctx, query)
+	return err
+}
+
+// apply runs the up or down sql of mg in a transaction along with the update of
+// the schema table. Where DDL is not transactional, as in MySQL, the version is
+// marked dirty first, so that a failure halfway is not ignored by the next run.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration, up bool) (err error) {
+	content, direction := mg.Up, "up"
+	if !up {
+		content, direction = mg.Down, "down"
+		if strings.TrimSpace(content) == "" {
+			log.Errorw(ctx, "migrate down error", "db_name", m.dbName, "version", mg.Version, "name", mg.Name, "err", ErrMissingDown)
+			return ErrMissingDown
+		}
+	}
+
+	defer func(begin time.Time) {
+		if err != nil {
+			log.Errorw(ctx, "migrate "+direction+" error", "db_name", m.dbName, "version", mg.Version, "name", mg.Name, "err", err)
+			return
+		}
+		log.Infow(ctx, "migrate "+direction, "db_name", m.dbName, "version", mg.Version, "name", mg.Name,
+			"request_time", fmt.Sprintf("%.3f", float32(time.Since(begin).Microseconds())/1000))
+	}(time.Now())
+
+	transactional := m.transactionalDDL()
+	if !transactional {
+		var query string
+		var args []interface{}
+		if up {
+			query = fmt.Sprintf("INSERT INTO %s (version, name, dirty) VALUES (?, ?, TRUE)", m.opts.table)
+			args = []interface{}{mg.Version, mg.Name}
+		} else {
+			query = fmt.Sprintf("UPDATE %s SET dirty = TRUE WHERE version = ?", m.opts.table)
+			args = []interface{}{mg.Version}
+		}
+		if _, err = conn.ExecContext(ctx, m.bind(query), args...); err != nil {
+			return err
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(content, m.driver == "mysql") {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	var query string
+	var args []interface{}
+	switch {
+	case !up:
+		query = fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.opts.table)
+		args = []interface{}{mg.Version}
+	case transactional:
+		query = fmt.Sprintf("INSERT INTO %s (version, name, dirty, applied_at) VALUES (?, ?, FALSE, CURRENT_TIMESTAMP)", m.opts.table)
+		args = []interface{}{mg.Version, mg.Name}
+	default:
+		query = fmt.Sprintf("UPDATE %s SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = ?", m.opts.table)
+		args = []interface{}{mg.Version}
+	}
+	if _, err = tx.ExecContext(ctx, m.bind(query), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// transactionalDDL reports whether the schema changes can be rolled back.
+func (m *Migrator) transactionalDDL() bool {
+	switch m.driver {
+	case "postgres", "pgx", "sqlite3", "sqlite":
+		return true
+	}
+	return false
+}
+
+// bind rewrites the `?` placeholders of query for the driver.
+func (m *Migrator) bind(query string) string {
+	if m.driver != "postgres" && m.driver != "pgx" {
+		return query
+	}
+
+	var b strings.Builder
+	var n int
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
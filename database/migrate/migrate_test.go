@@ -0,0 +1,254 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/database"
+	"github.com/WiFeng/go-sky/log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	testName    = "sqlite1"
+	testService = "testService"
+)
+
+func TestMain(m *testing.M) {
+	logConf := config.Log{
+		Level: "info",
+	}
+	if _, err := log.Init(context.Background(), testService, logConf); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	dir, err := os.MkdirTemp("", "migrate_test")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	database.Init(context.Background(), testService, []config.Database{
+		{
+			Name:   testName,
+			Driver: "sqlite3",
+			DB:     filepath.Join(dir, "test.db"),
+		},
+	})
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testMigrations returns the migrations creating the tables of the prefix,
+// and the schema table of the prefix to track them.
+func testMigrations(prefix string) (fstest.MapFS, Option) {
+	fsys := fstest.MapFS{
+		"1_create_user.up.sql":   {Data: []byte(fmt.Sprintf("CREATE TABLE %s_user (id INTEGER PRIMARY KEY);", prefix))},
+		"1_create_user.down.sql": {Data: []byte(fmt.Sprintf("DROP TABLE %s_user;", prefix))},
+		"2_add_email.up.sql":     {Data: []byte(fmt.Sprintf("CREATE TABLE %s_email (user_id INTEGER, email TEXT);\nCREATE INDEX %s_idx_email ON %s_email (email);", prefix, prefix, prefix))},
+		"2_add_email.down.sql":   {Data: []byte(fmt.Sprintf("DROP INDEX %s_idx_email;\nDROP TABLE %s_email;", prefix, prefix))},
+		"3_create_order.up.sql":  {Data: []byte(fmt.Sprintf("CREATE TABLE %s_order (id INTEGER PRIMARY KEY);", prefix))},
+	}
+	return fsys, WithTable(prefix + "_schema_migrations")
+}
+
+func tableExists(t *testing.T, name string) bool {
+	t.Helper()
+	db, err := database.GetInstance(context.Background(), testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+func states(status []Status) string {
+	var s []string
+	for _, st := range status {
+		state := "pending"
+		if st.Dirty {
+			state = "dirty"
+		} else if st.Applied {
+			state = "applied"
+		}
+		s = append(s, fmt.Sprintf("%d:%s", st.Version, state))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestUpDownStatus(t *testing.T) {
+	var ctx = context.Background()
+	fsys, table := testMigrations("updown")
+
+	m, err := New(ctx, testName, fsys, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := m.Up(ctx); err != nil || n != 3 {
+		t.Fatalf("Up = %d, %v; want 3", n, err)
+	}
+	if !tableExists(t, "updown_user") || !tableExists(t, "updown_order") {
+		t.Error("tables are not created by Up")
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Errorf("Up again = %d, %v; want 0", n, err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := states(status), "1:applied 2:applied 3:applied"; got != want {
+		t.Errorf("Status = %s; want %s", got, want)
+	}
+	if status[0].AppliedAt == "" {
+		t.Errorf("Status applied at is empty: %+v", status[0])
+	}
+
+	// The migration 3 has no down sql, nothing is reverted.
+	if n, err := m.Down(ctx, 1); err != ErrMissingDown || n != 0 {
+		t.Errorf("Down = %d, %v; want 0, %v", n, err, ErrMissingDown)
+	}
+
+	if err = m.Force(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Down(ctx, 5); err != nil || n != 2 {
+		t.Fatalf("Down = %d, %v; want 2", n, err)
+	}
+	if tableExists(t, "updown_user") || tableExists(t, "updown_email") {
+		t.Error("tables are not dropped by Down")
+	}
+
+	if status, err = m.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := states(status), "1:pending 2:pending 3:pending"; got != want {
+		t.Errorf("Status = %s; want %s", got, want)
+	}
+}
+
+func TestUpFailure(t *testing.T) {
+	var ctx = context.Background()
+	fsys, table := testMigrations("failure")
+	fsys["2_add_email.up.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE failure_user ADD email TEXT;\nALTER TABLE not_found ADD name TEXT;")}
+
+	m, err := New(ctx, testName, fsys, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed migration is rolled back with its schema changes, as the DDL
+	// of sqlite is transactional, and the next ones are not applied.
+	if n, err := m.Up(ctx); err == nil || n != 1 {
+		t.Fatalf("Up = %d, %v; want 1 and an error", n, err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := states(status), "1:applied 2:pending 3:pending"; got != want {
+		t.Errorf("Status = %s; want %s", got, want)
+	}
+
+	db, _ := database.GetInstance(ctx, testName)
+	if _, err = db.Exec("SELECT email FROM failure_user"); err == nil {
+		t.Error("the column of the failed migration is not rolled back")
+	}
+}
+
+func TestDirty(t *testing.T) {
+	var ctx = context.Background()
+	fsys, table := testMigrations("dirty")
+
+	m, err := New(ctx, testName, fsys, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The migration 1 failed halfway on a driver without transactional DDL.
+	db, _ := database.GetInstance(ctx, testName)
+	if _, err = db.Exec("INSERT INTO dirty_schema_migrations (version, name, dirty) VALUES (1, 'create_user', TRUE)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := m.Up(ctx); err != ErrDirty || n != 0 {
+		t.Errorf("Up = %d, %v; want 0, %v", n, err, ErrDirty)
+	}
+	if n, err := m.Down(ctx, 1); err != ErrDirty || n != 0 {
+		t.Errorf("Down = %d, %v; want 0, %v", n, err, ErrDirty)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := states(status), "1:dirty 2:pending 3:pending"; got != want {
+		t.Errorf("Status = %s; want %s", got, want)
+	}
+
+	if err = m.Force(ctx, 4); err != ErrVersionNotFound {
+		t.Errorf("Force = %v; want %v", err, ErrVersionNotFound)
+	}
+
+	// The schema is fixed by hand, and the version is forced to the one before.
+	if err = m.Force(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 3 {
+		t.Errorf("Up after Force = %d, %v; want 3", n, err)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	var ctx = context.Background()
+	fsys, table := testMigrations("command")
+
+	if ok, err := RunCommand(ctx, []string{"serve"}, testName, fsys, table); ok || err != nil {
+		t.Errorf("RunCommand serve = %v, %v; want false, nil", ok, err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+		err  error
+	}{
+		{[]string{"up"}, "3 migrations applied\n", nil},
+		{[]string{"force", "2"}, "version forced to 2\n", nil},
+		{[]string{"down", "2"}, "2 migrations reverted\n", nil},
+		{[]string{"force"}, "migrate force error: " + ErrVersionNotFound.Error() + "\n", ErrVersionNotFound},
+		{[]string{"unknown"}, "migrate unknown error: " + ErrUnknownCommand.Error() + "\n", ErrUnknownCommand},
+	} {
+		var w bytes.Buffer
+		if err := runCommand(ctx, &w, tt.args, testName, fsys, table); err != tt.err || w.String() != tt.want {
+			t.Errorf("runCommand %v = %q, %v; want %q, %v", tt.args, w.String(), err, tt.want, tt.err)
+		}
+	}
+
+	var w bytes.Buffer
+	if err := runCommand(ctx, &w, nil, testName, fsys, table); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "VERSION") ||
+		!strings.Contains(lines[1], "pending") || !strings.Contains(lines[3], "pending") {
+		t.Errorf("runCommand status = %q", w.String())
+	}
+}
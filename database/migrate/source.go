@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrDuplicateVersion ...
+	ErrDuplicateVersion = errors.New("migration version is duplicated")
+)
+
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change, which is loaded from
+// the files `<version>_<name>.up.sql` and `<version>_<name>.down.sql`.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations in the root directory of fsys, sorted by version.
+// The files not named as migrations are ignored. Use os.DirFS for a directory,
+// or fs.Sub to load the migrations embedded in a subdirectory of an embed.FS.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			migrations[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), ErrDuplicateVersion)
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var sorted []Migration
+	for _, m := range migrations {
+		sorted = append(sorted, *m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted, nil
+}
+
+// splitStatements splits the content of a migration file into statements
+// separated by `;`, skipping the ones in quotes, comments and dollar quotes.
+// The lines starting with `#` are comments too if hashComment is true, as MySQL does.
+func splitStatements(content string, hashComment bool) []string {
+	var statements []string
+	var start int
+
+	add := func(end int) {
+		if stmt := strings.TrimSpace(content[start:end]); stmt != "" && !isComment(stmt, hashComment) {
+			statements = append(statements, stmt)
+		}
+	}
+
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(content); i++ {
+				if content[i] == '\\' && c != '`' {
+					i++
+				} else if content[i] == c {
+					break
+				}
+			}
+		case c == '-' && strings.HasPrefix(content[i:], "--"), c == '#' && hashComment:
+			if j := strings.IndexByte(content[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(content)
+			}
+		case c == '/' && strings.HasPrefix(content[i:], "/*"):
+			if j := strings.Index(content[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(content)
+			}
+		case c == '$':
+			// Dollar quotes of PostgreSQL, e.g. $$...$$ or $body$...$body$.
+			j := strings.IndexByte(content[i+1:], '$')
+			if j < 0 || !isTag(content[i+1:i+1+j]) {
+				continue
+			}
+			tag := content[i : i+j+2]
+			if k := strings.Index(content[i+len(tag):], tag); k >= 0 {
+				i += len(tag) + k + len(tag) - 1
+			} else {
+				i = len(content)
+			}
+		case c == ';':
+			add(i)
+			start = i + 1
+		}
+	}
+
+	if start < len(content) {
+		add(len(content))
+	}
+	return statements
+}
+
+func isTag(s string) bool {
+	for i, r := range s {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// isComment reports whether stmt only contains comments.
+func isComment(stmt string, hashComment bool) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") && !(hashComment && strings.HasPrefix(line, "#")) {
+			return false
+		}
+	}
+	return true
+}
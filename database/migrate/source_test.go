@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2_add_email.up.sql":      {Data: []byte("ALTER TABLE user ADD email VARCHAR(255);")},
+		"2_add_email.down.sql":    {Data: []byte("ALTER TABLE user DROP email;")},
+		"10_add_index.up.sql":     {Data: []byte("CREATE INDEX idx_email ON user (email);")},
+		"1_create_user.up.sql":    {Data: []byte("CREATE TABLE user (id INT);")},
+		"1_create_user.down.sql":  {Data: []byte("DROP TABLE user;")},
+		"README.md":               {Data: []byte("not a migration")},
+		"sub/3_ignored.up.sql":    {Data: []byte("SELECT 1;")},
+		"4_no_direction.sql":      {Data: []byte("SELECT 1;")},
+		"5_missing_down.up.sql":   {Data: []byte("SELECT 1;")},
+		"5_missing_down.down.sql": {Data: []byte("")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int64
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	if want := []int64{1, 2, 5, 10}; !reflect.DeepEqual(versions, want) {
+		t.Fatalf("Load versions = %v; want %v", versions, want)
+	}
+
+	if m := migrations[1]; m.Name != "add_email" || m.Down != "ALTER TABLE user DROP email;" {
+		t.Errorf("Load migration 2 = %+v", m)
+	}
+	if m := migrations[3]; m.Up == "" || m.Down != "" {
+		t.Errorf("Load migration 10 = %+v", m)
+	}
+}
+
+func TestLoadDuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_create_user.up.sql":  {Data: []byte("CREATE TABLE user (id INT);")},
+		"1_create_order.up.sql": {Data: []byte("CREATE TABLE order (id INT);")},
+	}
+
+	if _, err := Load(fsys); !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("Load = %v; want %v", err, ErrDuplicateVersion)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		content     string
+		hashComment bool
+		want        []string
+	}{
+		{
+			content: "CREATE TABLE a (id INT);\n\nCREATE TABLE b (id INT)\n",
+			want:    []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			content: "INSERT INTO a VALUES ('x;y', \"z;\", 'it\\'s;');",
+			want:    []string{"INSERT INTO a VALUES ('x;y', \"z;\", 'it\\'s;')"},
+		},
+		{
+			content: "-- comment;\nSELECT 1; /* block; comment */ SELECT 2;\n-- trailing;",
+			want:    []string{"-- comment;\nSELECT 1", "/* block; comment */ SELECT 2"},
+		},
+		{
+			content:     "# mysql comment;\nSELECT 1;\n# only comment\n",
+			hashComment: true,
+			want:        []string{"# mysql comment;\nSELECT 1"},
+		},
+		{
+			content: "SELECT '{1}'::jsonb #> '{a}';",
+			want:    []string{"SELECT '{1}'::jsonb #> '{a}'"},
+		},
+		{
+			content: "CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;\nSELECT $$a;b$$;",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql",
+				"SELECT $$a;b$$",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := splitStatements(tt.content, tt.hashComment); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitStatements(%q) = %q; want %q", tt.content, got, tt.want)
+		}
+	}
+}
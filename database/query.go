@@ -0,0 +1,460 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrInvalidDest ...
+	ErrInvalidDest = errors.New("database dest must be a non-nil pointer")
+	// ErrColumnNotFound ...
+	ErrColumnNotFound = errors.New("database column has no destination field")
+	// ErrParamNotFound ...
+	ErrParamNotFound = errors.New("database named parameter is not found")
+	// ErrArgsMismatch ...
+	ErrArgsMismatch = errors.New("database placeholders and args mismatch")
+	// ErrEmptySlice ...
+	ErrEmptySlice = errors.New("database slice arg is empty")
+)
+
+// Queryer is implemented by *sql.DB, *sql.Tx, *sql.Conn and *DB.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Execer is implemented by *sql.DB, *sql.Tx, *sql.Conn and *DB.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// QueryStruct scans the first row of query into dest, which is a pointer to a struct,
+// or to a scannable value for a single column. It returns sql.ErrNoRows if there is
+// no row. The slice args are expanded as In does.
+//
+// The columns are mapped to the fields by the `db` tag, or by the snake case of the
+// field names if not tagged. The fields tagged `db:"-"` are skipped, and the fields
+// of embedded structs are mapped as the ones of the outer struct.
+func QueryStruct(ctx context.Context, q Queryer, dest interface{}, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrInvalidDest
+	}
+
+	query, args, err := In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if err = scanRow(rows, columns, v.Elem()); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// QueryStructs scans all the rows of query into dest, which is a pointer to a slice
+// of structs or of pointers to structs. See QueryStruct for how columns are mapped.
+func QueryStructs(ctx context.Context, q Queryer, dest interface{}, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return ErrInvalidDest
+	}
+
+	query, args, err := In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	for rows.Next() {
+		elem := reflect.New(elemType)
+		if err = scanRow(rows, columns, elem.Elem()); err != nil {
+			return err
+		}
+
+		if isPtr {
+			slice = reflect.Append(slice, elem)
+		} else {
+			slice = reflect.Append(slice, elem.Elem())
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	v.Elem().Set(slice)
+	return nil
+}
+
+// NamedExec executes query with the `:name` parameters bound from arg, see Named.
+// The query is executed with `?` placeholders, so for postgres and pgx, execute the
+// query of Named converted by Rebind instead.
+func NamedExec(ctx context.Context, e Execer, query string, arg interface{}) (sql.Result, error) {
+	query, args, err := Named(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args...)
+}
+
+// Named rewrites the `:name` parameters of query to `?` placeholders, and returns the
+// args bound from arg, which is a struct, a pointer to a struct or a map[string]interface{}.
+// The struct fields are named as the columns of QueryStruct. The slice args are expanded
+// as In does. `::` is kept as it is, e.g. a PostgreSQL cast. Use Rebind to convert the
+// placeholders for the drivers which don't support `?`, e.g. postgres and pgx.
+func Named(query string, arg interface{}) (string, []interface{}, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var b strings.Builder
+	var args []interface{}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case isQuote(c):
+			end := quotedEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i++
+			continue
+		case c == ':' && i+1 < len(query) && isNameChar(query[i+1]):
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+
+			name := query[i+1 : j]
+			value, ok := lookup(name)
+			if !ok {
+				return "", nil, fmt.Errorf("%w: %s", ErrParamNotFound, name)
+			}
+
+			b.WriteByte('?')
+			args = append(args, value)
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return In(b.String(), args...)
+}
+
+// In expands the `?` placeholders whose args are slices, e.g. `id IN (?)` with
+// []int{1, 2, 3} to `id IN (?, ?, ?)`. []byte and driver.Valuer args are not expanded.
+// Use Rebind to convert the placeholders for the drivers which don't support `?`.
+func In(query string, args ...interface{}) (string, []interface{}, error) {
+	var expand bool
+	for _, arg := range args {
+		if isExpandable(arg) {
+			expand = true
+			break
+		}
+	}
+	if !expand {
+		return query, args, nil
+	}
+
+	var b strings.Builder
+	var expanded []interface{}
+	var n int
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case isQuote(c):
+			end := quotedEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		case c == '?':
+			if n >= len(args) {
+				return "", nil, ErrArgsMismatch
+			}
+			arg := args[n]
+			n++
+
+			if !isExpandable(arg) {
+				expanded = append(expanded, arg)
+				break
+			}
+
+			v := reflect.ValueOf(arg)
+			if v.Len() == 0 {
+				return "", nil, ErrEmptySlice
+			}
+			for k := 0; k < v.Len(); k++ {
+				if k > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteByte('?')
+				expanded = append(expanded, v.Index(k).Interface())
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	if n != len(args) {
+		return "", nil, ErrArgsMismatch
+	}
+	return b.String(), expanded, nil
+}
+
+// Rebind converts the `?` placeholders of query to the placeholder style of driverName,
+// which is `$1`, `$2`... for postgres and pgx. The query of other drivers is returned as it is.
+func Rebind(driverName string, query string) string {
+	if driverName != "postgres" && driverName != "pgx" {
+		return query
+	}
+
+	var b strings.Builder
+	var n int
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case isQuote(c):
+			end := quotedEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isQuote(c byte) bool {
+	return c == '\'' || c == '"' || c == '`'
+}
+
+// quotedEnd returns the index after the closing quote of the quoted string or
+// identifier starting at i. A backslash escapes the next byte in the strings.
+func quotedEnd(query string, i int) int {
+	quote := query[i]
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+func isExpandable(arg interface{}) bool {
+	if arg == nil {
+		return false
+	}
+	if _, ok := arg.(driver.Valuer); ok {
+		return false
+	}
+	if _, ok := arg.([]byte); ok {
+		return false
+	}
+
+	kind := reflect.TypeOf(arg).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func namedLookup(arg interface{}) (func(name string) (interface{}, bool), error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		return func(name string) (interface{}, bool) {
+			value, ok := m[name]
+			return value, ok
+		}, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, ErrInvalidDest
+	}
+
+	fields := structFields(v.Type())
+	return func(name string) (interface{}, bool) {
+		index, ok := fields[name]
+		if !ok {
+			return nil, false
+		}
+
+		f, ok := fieldByIndex(v, index, false)
+		if !ok {
+			return nil, true
+		}
+		return f.Interface(), true
+	}, nil
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// scanRow scans the current row into v, a struct or a value for a single column.
+func scanRow(rows *sql.Rows, columns []string, v reflect.Value) error {
+	if v.Kind() != reflect.Struct || v.Type() == timeType || reflect.PtrTo(v.Type()).Implements(scannerType) {
+		return rows.Scan(v.Addr().Interface())
+	}
+
+	fields := structFields(v.Type())
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		index, ok := fields[column]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrColumnNotFound, column)
+		}
+
+		f, _ := fieldByIndex(v, index, true)
+		dest[i] = f.Addr().Interface()
+	}
+	return rows.Scan(dest...)
+}
+
+// fieldByIndex returns the field of v at index. The nil pointers of embedded structs
+// are allocated if alloc is true, otherwise it reports false on them.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var fieldsCache sync.Map
+
+// structFields returns the index of the fields of t by column name.
+func structFields(t reflect.Type) map[string][]int {
+	if fields, ok := fieldsCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+
+	fields := map[string][]int{}
+	addStructFields(fields, t, nil)
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+func addStructFields(fields map[string][]int, t reflect.Type, parent []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		// The unexported fields are skipped, except the embedded
+		// structs whose exported fields are promoted.
+		if tag == "-" || f.PkgPath != "" && (!f.Anonymous || f.Type.Kind() == reflect.Ptr) {
+			continue
+		}
+
+		index := append(append([]int{}, parent...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			addStructFields(fields, ft, index)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+
+		// The fields of the outer struct win.
+		if _, ok := fields[name]; !ok || len(index) <= len(fields[name]) {
+			fields[name] = index
+		}
+	}
+}
+
+// snakeCase converts a field name to the snake case, e.g. UserID to user_id.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIn(t *testing.T) {
+	query, args, err := In("SELECT * FROM user WHERE id IN (?) AND name = ? AND data = ?", []int{1, 2, 3}, "a", []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "SELECT * FROM user WHERE id IN (?, ?, ?) AND name = ? AND data = ?"; query != want {
+		t.Errorf("In query = %s; want %s", query, want)
+	}
+	if want := []interface{}{1, 2, 3, "a", []byte("b")}; !reflect.DeepEqual(args, want) {
+		t.Errorf("In args = %v; want %v", args, want)
+	}
+
+	if _, _, err = In("SELECT * FROM user WHERE id IN (?)", []int{}); err != ErrEmptySlice {
+		t.Errorf("In empty slice = %v; want %v", err, ErrEmptySlice)
+	}
+	if _, _, err = In("SELECT * FROM user WHERE id IN (?) AND name = '?'", []int{1}, "a"); err != ErrArgsMismatch {
+		t.Errorf("In mismatch = %v; want %v", err, ErrArgsMismatch)
+	}
+
+	// The escaped quote doesn't end the string.
+	query, _, err = In(`SELECT * FROM user WHERE note = 'it\'s ?' AND id IN (?)`, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT * FROM user WHERE note = 'it\'s ?' AND id IN (?, ?)`; query != want {
+		t.Errorf("In query = %s; want %s", query, want)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := `SELECT * FROM "user" WHERE id IN (?, ?) AND note = 'it\'s ?' AND name = ?`
+	if got := Rebind("mysql", query); got != query {
+		t.Errorf("Rebind mysql = %s; want %s", got, query)
+	}
+
+	want := `SELECT * FROM "user" WHERE id IN ($1, $2) AND note = 'it\'s ?' AND name = $3`
+	for _, driverName := range []string{"postgres", "pgx"} {
+		if got := Rebind(driverName, query); got != want {
+			t.Errorf("Rebind %s = %s; want %s", driverName, got, want)
+		}
+	}
+}
+
+type testBase struct {
+	ID int64
+}
+
+type testUser struct {
+	testBase
+	UserName string `db:"name"`
+	Email    sql.NullString
+	Ignored  string `db:"-"`
+}
+
+func TestNamed(t *testing.T) {
+	user := testUser{testBase: testBase{ID: 1}, UserName: "a"}
+	query, args, err := Named("UPDATE user SET name = :name, note = ':skip', created = NOW()::date WHERE id IN (:ids) OR id = :id", map[string]interface{}{
+		"name": user.UserName,
+		"ids":  []int64{2, 3},
+		"id":   user.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "UPDATE user SET name = ?, note = ':skip', created = NOW()::date WHERE id IN (?, ?) OR id = ?"; query != want {
+		t.Errorf("Named query = %s; want %s", query, want)
+	}
+	if want := []interface{}{"a", int64(2), int64(3), int64(1)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Named args = %v; want %v", args, want)
+	}
+
+	query, args, err = Named("INSERT INTO user (id, name, email) VALUES (:id, :name, :email)", &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{int64(1), "a", sql.NullString{}}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Named struct args = %v; want %v", args, want)
+	}
+
+	if _, _, err = Named("SELECT :ignored", user); !errors.Is(err, ErrParamNotFound) {
+		t.Errorf("Named not found = %v; want %v", err, ErrParamNotFound)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"ID":        "id",
+		"UserID":    "user_id",
+		"UserName":  "user_name",
+		"HTTPCode":  "http_code",
+		"CreatedAt": "created_at",
+	}
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%s) = %s; want %s", name, got, want)
+		}
+	}
+}
+
+func TestQueryStructs(t *testing.T) {
+	var ctx = context.Background()
+	db, err := GetInstance(ctx, testSQLite)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var users []*testUser
+	err = QueryStructs(ctx, db, &users, "SELECT * FROM (SELECT 1 AS id, 'a' AS name, NULL AS email UNION ALL SELECT 2, 'b', 'b@x') t WHERE id IN (?) ORDER BY id", []int{1, 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(users) != 2 || users[0].UserName != "a" || users[1].ID != 2 || users[1].Email.String != "b@x" {
+		t.Errorf("QueryStructs = %+v", users)
+	}
+
+	var user testUser
+	if err = QueryStruct(ctx, db, &user, "SELECT 3 AS id, 'c' AS name"); err != nil || user.ID != 3 {
+		t.Errorf("QueryStruct = %+v, %v", user, err)
+	}
+
+	if err = QueryStruct(ctx, db, &user, "SELECT 1 AS unknown"); !errors.Is(err, ErrColumnNotFound) {
+		t.Errorf("QueryStruct = %v; want %v", err, ErrColumnNotFound)
+	}
+}
@@ -0,0 +1,310 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/helper"
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+)
+
+var (
+	clusterMap = map[string]*DB{}
+)
+
+var (
+	// ErrReplicationNotRunning ...
+	ErrReplicationNotRunning = errors.New("database replication is not running")
+	// ErrReplicaLagging ...
+	ErrReplicaLagging = errors.New("database replica lags too much")
+	// ErrReplicaDataSource ...
+	ErrReplicaDataSource = errors.New("database replica requires a data source when the primary has one")
+)
+
+type primaryContextKey int
+
+const (
+	forcePrimary primaryContextKey = 0
+)
+
+// WithPrimary returns a context that makes the reads of DB go to the primary,
+// e.g. to read the rows written by the same request.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimary, true)
+}
+
+func isPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forcePrimary).(bool)
+	return forced
+}
+
+// DB routes the reads to the healthy replicas of a database instance in
+// round robin, and the writes and transactions to the primary. The reads go
+// to the primary too when no replica is healthy or the context is created by
+// WithPrimary.
+type DB struct {
+	name     string
+	primary  *sql.DB
+	replicas []*replica
+	next     uint32
+}
+
+type replica struct {
+	instance string
+	db       *sql.DB
+	healthy  int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// GetDB returns the read/write splitting handle of the database instance.
+func GetDB(ctx context.Context, instanceName string) (*DB, error) {
+	db, ok := clusterMap[instanceName]
+	if !ok {
+		err := ErrConfigNotFound
+		log.Errorw(ctx, "database.GetDB, instanceName is not in clusterMap map", "instance_name", instanceName, "err", err)
+		return nil, err
+	}
+	return db, nil
+}
+
+func newCluster(ctx context.Context, cf config.Database, primary *sql.DB) *DB {
+	db := &DB{
+		name:    cf.Name,
+		primary: primary,
+	}
+	if len(cf.Replicas) == 0 {
+		return db
+	}
+
+	for i, rcf := range cf.Replicas {
+		instance := fmt.Sprintf("%s.replica.%d", cf.Name, i)
+		rcf, err := replicaConfig(cf, rcf)
+		if err != nil {
+			log.Fatalw(ctx, "database replica config error", "name", cf.Name, "instance", instance, "err", err)
+			continue
+		}
+
+		rdb, err := open(ctx, instance, rcf)
+		if rdb == nil {
+			log.Fatalw(ctx, "database open replica error", "name", cf.Name, "instance", instance, "err", err)
+			continue
+		}
+		if err != nil {
+			// A replica being down does not stop the service,
+			// it's not read from until the check passes.
+			log.Warnw(ctx, "database ping replica error", "name", cf.Name, "instance", instance, "err", err)
+		}
+
+		skyprome.RegisterDatabaseStats(instance, rdb.Stats)
+		db.replicas = append(db.replicas, &replica{instance: instance, db: rdb})
+	}
+
+	interval := cf.ReplicaCheckIntervalMillSec * time.Millisecond
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	db.check(ctx, cf)
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				db.check(context.Background(), cf)
+			}
+		}
+	}()
+	helper.AddDeferFunc(func() {
+		close(stop)
+	})
+
+	return db
+}
+
+// replicaConfig returns the config of a replica, which inherits the empty fields from the primary.
+// The DataSource of the primary is not inherited, since the host can't be replaced in it, so the
+// replica of a primary configured by DataSource must have its own.
+func replicaConfig(cf config.Database, rcf config.DatabaseReplica) (config.Database, error) {
+	if cf.DataSource != "" && rcf.DataSource == "" {
+		return cf, ErrReplicaDataSource
+	}
+
+	cf.Replicas = nil
+	cf.DataSource = rcf.DataSource
+	if rcf.Host != "" {
+		cf.Host = rcf.Host
+	}
+	if rcf.Port != 0 {
+		cf.Port = rcf.Port
+	}
+	if rcf.User != "" {
+		cf.User = rcf.User
+	}
+	if rcf.Pass != "" {
+		cf.Pass = rcf.Pass
+	}
+	return cf, nil
+}
+
+// check pings every replica and measures its lag, the replicas
+// which fail or lag more than ReplicaMaxLagMillSec are not read from.
+func (db *DB) check(ctx context.Context, cf config.Database) {
+	for _, r := range db.replicas {
+		cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		lag, err := checkReplica(cctx, r.db, cf)
+		cancel()
+
+		if err == nil && cf.ReplicaMaxLagMillSec > 0 && lag > (cf.ReplicaMaxLagMillSec*time.Millisecond).Seconds() {
+			err = ErrReplicaLagging
+		}
+
+		var healthy int32
+		if err == nil {
+			healthy = 1
+		}
+		if old := atomic.SwapInt32(&r.healthy, healthy); old != healthy {
+			if err != nil {
+				log.Warnw(ctx, "database replica is unhealthy", "name", db.name, "instance", r.instance, "lag", lag, "err", err)
+			} else {
+				log.Infow(ctx, "database replica is healthy", "name", db.name, "instance", r.instance, "lag", lag)
+			}
+		}
+	}
+}
+
+// checkReplica pings the replica and returns its lag in seconds.
+func checkReplica(ctx context.Context, db *sql.DB, cf config.Database) (float64, error) {
+	if err := db.PingContext(ctx); err != nil {
+		return 0, err
+	}
+
+	if cf.ReplicaMaxLagMillSec <= 0 {
+		return 0, nil
+	}
+
+	if cf.ReplicaLagQuery != "" {
+		var lag float64
+		err := db.QueryRowContext(ctx, cf.ReplicaLagQuery).Scan(&lag)
+		return lag, err
+	}
+
+	switch cf.Driver {
+	case "mysql":
+		return mysqlReplicaLag(ctx, db)
+	case "postgres", "pgx":
+		// The lag grows when the primary has no writes, set
+		// ReplicaLagQuery to measure it in another way.
+		var lag float64
+		err := db.QueryRowContext(ctx, "SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)").Scan(&lag)
+		return lag, err
+	}
+	return 0, nil
+}
+
+func mysqlReplicaLag(ctx context.Context, db *sql.DB) (float64, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	// Not a replica.
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" && column != "Seconds_Behind_Source" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, ErrReplicationNotRunning
+		}
+
+		var lag float64
+		if _, err = fmt.Sscan(string(values[i]), &lag); err != nil {
+			return 0, err
+		}
+		return lag, nil
+	}
+	return 0, nil
+}
+
+// Primary returns the primary database.
+func (db *DB) Primary() *sql.DB {
+	return db.primary
+}
+
+// Reader returns the database which the reads with ctx go to.
+func (db *DB) Reader(ctx context.Context) *sql.DB {
+	if len(db.replicas) == 0 || isPrimaryForced(ctx) {
+		return db.primary
+	}
+
+	n := uint32(len(db.replicas))
+	start := atomic.AddUint32(&db.next, 1)
+	for i := uint32(0); i < n; i++ {
+		if r := db.replicas[(start+i)%n]; r.isHealthy() {
+			return r.db
+		}
+	}
+	return db.primary
+}
+
+// QueryContext ...
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.Reader(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext ...
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.Reader(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext ...
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.primary.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext prepares the statement on the primary.
+func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return db.primary.PrepareContext(ctx, query)
+}
+
+// BeginTx ...
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return db.primary.BeginTx(ctx, opts)
+}
+
+// PingContext ...
+func (db *DB) PingContext(ctx context.Context) error {
+	return db.primary.PingContext(ctx)
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/WiFeng/go-sky/config"
+)
+
+func TestReplicaConfig(t *testing.T) {
+	primary := config.Database{Name: "db1", Host: "10.0.0.1", Port: 3306, User: "root", Pass: "123456", DB: "test"}
+
+	cf, err := replicaConfig(primary, config.DatabaseReplica{Host: "10.0.0.2", User: "reader"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cf.Host != "10.0.0.2" || cf.Port != 3306 || cf.User != "reader" || cf.Pass != "123456" || cf.DB != "test" {
+		t.Errorf("replicaConfig = %+v", cf)
+	}
+
+	primary.DataSource = "root:123456@tcp(10.0.0.1:3306)/test"
+	if _, err = replicaConfig(primary, config.DatabaseReplica{Host: "10.0.0.2"}); err != ErrReplicaDataSource {
+		t.Errorf("replicaConfig without DataSource = %v; want %v", err, ErrReplicaDataSource)
+	}
+
+	rds := "root:123456@tcp(10.0.0.2:3306)/test"
+	if cf, err = replicaConfig(primary, config.DatabaseReplica{DataSource: rds}); err != nil || cf.DataSource != rds {
+		t.Errorf("replicaConfig = %s, %v; want %s", cf.DataSource, err, rds)
+	}
+}
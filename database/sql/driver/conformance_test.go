@@ -0,0 +1,285 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// legacyConn only implements driver.Conn, without any optional interface.
+type legacyConn struct {
+	conn *fakeConn
+}
+
+func (c legacyConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return legacyStmt{s.(*fakeStmt)}, nil
+}
+
+func (c legacyConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c legacyConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+// legacyStmt only implements driver.Stmt, without any optional interface.
+type legacyStmt struct {
+	stmt *fakeStmt
+}
+
+func (s legacyStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s legacyStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s legacyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s legacyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+type testResetter struct {
+	calls *int32
+}
+
+func (r testResetter) ResetSession(ctx context.Context) error {
+	atomic.AddInt32(r.calls, 1)
+	return nil
+}
+
+type testValidator struct{}
+
+func (testValidator) IsValid() bool {
+	return true
+}
+
+type point struct {
+	X, Y int
+}
+
+type testChecker struct{}
+
+func (testChecker) CheckNamedValue(nv *driver.NamedValue) error {
+	if p, ok := nv.Value.(point); ok {
+		nv.Value = fmt.Sprintf("%d,%d", p.X, p.Y)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// composeConn returns c with the optional interfaces selected by mask.
+func composeConn(c driver.Conn, mask int, resets *int32) driver.Conn {
+	r := testResetter{resets}
+	switch mask {
+	case 1:
+		return struct {
+			driver.Conn
+			testResetter
+		}{c, r}
+	case 2:
+		return struct {
+			driver.Conn
+			testValidator
+		}{c, testValidator{}}
+	case 3:
+		return struct {
+			driver.Conn
+			testResetter
+			testValidator
+		}{c, r, testValidator{}}
+	case 4:
+		return struct {
+			driver.Conn
+			testChecker
+		}{c, testChecker{}}
+	case 5:
+		return struct {
+			driver.Conn
+			testResetter
+			testChecker
+		}{c, r, testChecker{}}
+	case 6:
+		return struct {
+			driver.Conn
+			testValidator
+			testChecker
+		}{c, testValidator{}, testChecker{}}
+	case 7:
+		return struct {
+			driver.Conn
+			testResetter
+			testValidator
+			testChecker
+		}{c, r, testValidator{}, testChecker{}}
+	}
+	return c
+}
+
+type composeDriver struct {
+	fake   *fakeDriver
+	mask   int
+	legacy bool
+	resets int32
+}
+
+func (d *composeDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.fake.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var base driver.Conn = c
+	if d.legacy {
+		base = legacyConn{c.(*fakeConn)}
+	}
+	return composeConn(base, d.mask, &d.resets), nil
+}
+
+func openCompose(t *testing.T, name string, d *composeDriver) *sql.DB {
+	Register(name, d)
+	sql.Register("sky"+name, &Driver{BaseName: name})
+
+	db, err := sql.Open("sky"+name, "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestConnOptionalInterfaces(t *testing.T) {
+	for mask := 0; mask < 8; mask++ {
+		var resets int32
+		base := composeConn(legacyConn{&fakeConn{driver: newFakeDriver()}}, mask, &resets)
+		wrapped := newConn(&conn{base: base})
+
+		if _, got := wrapped.(driver.SessionResetter); got != (mask&1 != 0) {
+			t.Errorf("mask %d: SessionResetter = %v; want %v", mask, got, mask&1 != 0)
+		}
+		if _, got := wrapped.(driver.Validator); got != (mask&2 != 0) {
+			t.Errorf("mask %d: Validator = %v; want %v", mask, got, mask&2 != 0)
+		}
+		if _, got := wrapped.(driver.NamedValueChecker); got != (mask&4 != 0) {
+			t.Errorf("mask %d: NamedValueChecker = %v; want %v", mask, got, mask&4 != 0)
+		}
+
+		// The context interfaces are always implemented, with fallbacks.
+		if _, ok := wrapped.(driver.Pinger); !ok {
+			t.Errorf("mask %d: Pinger is not implemented", mask)
+		}
+		if _, ok := wrapped.(driver.ExecerContext); !ok {
+			t.Errorf("mask %d: ExecerContext is not implemented", mask)
+		}
+		if _, ok := wrapped.(driver.QueryerContext); !ok {
+			t.Errorf("mask %d: QueryerContext is not implemented", mask)
+		}
+		if _, ok := wrapped.(driver.ConnPrepareContext); !ok {
+			t.Errorf("mask %d: ConnPrepareContext is not implemented", mask)
+		}
+		if _, ok := wrapped.(driver.ConnBeginTx); !ok {
+			t.Errorf("mask %d: ConnBeginTx is not implemented", mask)
+		}
+	}
+}
+
+func TestStmtOptionalInterfaces(t *testing.T) {
+	base := legacyStmt{&fakeStmt{}}
+
+	wrapped := newStmt(&stmt{base: base})
+	if _, ok := wrapped.(driver.NamedValueChecker); ok {
+		t.Error("NamedValueChecker is implemented; want not")
+	}
+	if _, ok := wrapped.(driver.ColumnConverter); ok {
+		t.Error("ColumnConverter is implemented; want not")
+	}
+
+	wrapped = newStmt(&stmt{base: struct {
+		driver.Stmt
+		testChecker
+	}{base, testChecker{}}})
+	if _, ok := wrapped.(driver.NamedValueChecker); !ok {
+		t.Error("NamedValueChecker is not implemented; want implemented")
+	}
+}
+
+func TestLegacyConnFallback(t *testing.T) {
+	db := openCompose(t, "fakelegacy", &composeDriver{fake: newFakeDriver(), legacy: true})
+	defer db.Close()
+
+	var ctx = context.Background()
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatalf("db.PingContext = %v; want nil", err)
+	}
+
+	if _, err := db.ExecContext(ctx, "SET ?, ?", "key1", "val1"); err != nil {
+		t.Fatalf("db.ExecContext = %v; want nil", err)
+	}
+
+	var got string
+	if err := db.QueryRowContext(ctx, "GET ?", "key1").Scan(&got); err != nil {
+		t.Fatalf("db.QueryRowContext = %v; want nil", err)
+	}
+	if got != "val1" {
+		t.Errorf("db.QueryRowContext = %s; want val1", got)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("db.BeginTx = %v; want nil", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Errorf("tx.Commit = %v; want nil", err)
+	}
+
+	if _, err = db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+		t.Error("db.BeginTx read-only = nil; want error")
+	}
+}
+
+func TestNamedValueCheckerPassthrough(t *testing.T) {
+	db := openCompose(t, "fakechecker", &composeDriver{fake: newFakeDriver(), mask: 4})
+	defer db.Close()
+
+	var ctx = context.Background()
+	if _, err := db.ExecContext(ctx, "SET ?, ?", "key1", point{1, 2}); err != nil {
+		t.Fatalf("db.ExecContext = %v; want nil", err)
+	}
+
+	var got string
+	if err := db.QueryRowContext(ctx, "GET ?", "key1").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "1,2" {
+		t.Errorf("db.QueryRowContext = %s; want 1,2", got)
+	}
+}
+
+func TestSessionResetterPassthrough(t *testing.T) {
+	d := &composeDriver{fake: newFakeDriver(), mask: 1}
+	db := openCompose(t, "fakeresetter", d)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var ctx = context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := db.ExecContext(ctx, "SET ?, ?", "key1", "val1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if atomic.LoadInt32(&d.resets) == 0 {
+		t.Error("ResetSession is not called")
+	}
+}
@@ -2,8 +2,10 @@ package driver
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	opentracingext "github.com/opentracing/opentracing-go/ext"
@@ -18,20 +20,16 @@ var (
 
 // Conn ...
 type conn struct {
-	base        driver.Conn
-	pinger      driver.Pinger
-	execer      driver.ExecerContext
-	queryer     driver.QueryerContext
-	connPrepare driver.ConnPrepareContext
-	connBegin   driver.ConnBeginTx
+	base   driver.Conn
+	driver Driver
 }
 
 func (c *conn) Begin() (driver.Tx, error) {
-	return nil, ErrDeprecatedMethod
+	return c.BeginTx(context.Background(), driver.TxOptions{})
 }
 
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
-	return nil, ErrDeprecatedMethod
+	return c.PrepareContext(context.Background(), query)
 }
 
 func (c *conn) Close() error {
@@ -40,6 +38,12 @@ func (c *conn) Close() error {
 
 func (c *conn) Ping(ctx context.Context) (err error) {
 
+	// A base conn without Pinger is considered alive, as database/sql does.
+	pinger, ok := c.base.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
 
@@ -67,15 +71,15 @@ func (c *conn) Ping(ctx context.Context) (err error) {
 	}
 
 	// ============================================
-	pinger, ok := c.base.(driver.Pinger)
-	if !ok {
-		return ErrUnsupportedMethod
-	}
 	err = pinger.Ping(ctx)
 	return
 }
 
-func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (t driver.Tx, err error) {
+
+	defer func(begin time.Time) {
+		c.observe(ctx, operationBegin, "", nil, nil, err, begin)
+	}(time.Now())
 
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
@@ -97,6 +101,8 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx
 		childSpan = parentSpan.Tracer().StartSpan(
 			"sql.BeginTx",
 			opentracing.ChildOf(parentSpan.Context()),
+			opentracing.Tag{Key: "db.tx.isolation", Value: sql.IsolationLevel(opts.Isolation).String()},
+			opentracing.Tag{Key: "db.tx.read_only", Value: opts.ReadOnly},
 			opentracing.Tag{Key: string(opentracingext.DBType), Value: "sql"},
 			opentracing.Tag{Key: string(opentracingext.Component), Value: "database"},
 			opentracingext.SpanKindRPCClient,
@@ -104,15 +110,35 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx
 	}
 
 	// ============================================
-	connBegin, ok := c.base.(driver.ConnBeginTx)
-	if !ok {
-		return nil, ErrUnsupportedMethod
+	if connBegin, ok := c.base.(driver.ConnBeginTx); ok {
+		t, err = connBegin.BeginTx(ctx, opts)
+	} else {
+		t, err = c.begin(ctx, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t = &tx{
+		base: t,
+		conn: c,
+		ctx:  ctx,
+		opts: opts,
 	}
-	tx, err = connBegin.BeginTx(ctx, opts)
 	return
 }
 
-func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (r driver.Rows, err error) {
+
+	// database/sql prepares a statement instead on ErrSkip.
+	queryer, hasQueryer := c.base.(driver.QueryerContext)
+	legacyQueryer, hasLegacyQueryer := c.base.(driver.Queryer)
+	if !hasQueryer && !hasLegacyQueryer {
+		return nil, driver.ErrSkip
+	}
+
+	defer func(begin time.Time) {
+		c.observe(ctx, operationQuery, query, args, nil, err, begin)
+	}(time.Now())
 
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
@@ -143,16 +169,40 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 	}
 
 	// ============================================
-	queryer, ok := c.base.(driver.QueryerContext)
-	if !ok {
-		return nil, ErrUnsupportedMethod
+	if hasQueryer {
+		r, err = queryer.QueryContext(ctx, query, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValueToValue(args); err != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		r, err = legacyQueryer.Query(query, values)
 	}
-	rows, err = queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	r = newRows(ctx, r, time.Now())
 	return
 }
 
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
 
+	// database/sql prepares a statement instead on ErrSkip.
+	execer, hasExecer := c.base.(driver.ExecerContext)
+	legacyExecer, hasLegacyExecer := c.base.(driver.Execer)
+	if !hasExecer && !hasLegacyExecer {
+		return nil, driver.ErrSkip
+	}
+
+	defer func(begin time.Time) {
+		c.observe(ctx, operationExec, query, args, result, err, begin)
+	}(time.Now())
+
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
 
@@ -182,15 +232,29 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	}
 
 	// ============================================
-	execer, ok := c.base.(driver.ExecerContext)
-	if !ok {
-		return nil, ErrUnsupportedMethod
+	if hasExecer {
+		result, err = execer.ExecContext(ctx, query, args)
+		return
+	}
+
+	var values []driver.Value
+	if values, err = namedValueToValue(args); err != nil {
+		return nil, err
 	}
-	result, err = execer.ExecContext(ctx, query, args)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	result, err = legacyExecer.Exec(query, values)
 	return
 }
 
 func (c *conn) PrepareContext(ctx context.Context, query string) (s driver.Stmt, err error) {
+	defer func(begin time.Time) {
+		c.observe(ctx, operationPrepare, query, nil, nil, err, begin)
+	}(time.Now())
+
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
 
@@ -219,24 +283,27 @@ func (c *conn) PrepareContext(ctx context.Context, query string) (s driver.Stmt,
 	}
 
 	// ============================================
-	connPrepare, ok := c.base.(driver.ConnPrepareContext)
-	if !ok {
-		return nil, ErrUnsupportedMethod
+	var basestmt driver.Stmt
+	if connPrepare, ok := c.base.(driver.ConnPrepareContext); ok {
+		basestmt, err = connPrepare.PrepareContext(ctx, query)
+	} else {
+		basestmt, err = c.prepare(ctx, query)
 	}
-	basestmt, err := connPrepare.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	s = &stmt{
-		base: basestmt,
-	}
+	s = newStmt(&stmt{
+		base:  basestmt,
+		conn:  c,
+		query: query,
+	})
 	return
 }
 
 type stmt struct {
-	base    driver.Stmt
-	queryer driver.StmtQueryContext
-	execer  driver.StmtExecContext
+	base  driver.Stmt
+	conn  *conn
+	query string
 }
 
 func (s *stmt) Close() error {
@@ -248,14 +315,18 @@ func (s *stmt) NumInput() int {
 }
 
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
-	return nil, ErrDeprecatedMethod
+	return s.QueryContext(context.Background(), valueToNamedValue(args))
 }
 
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
-	return nil, ErrDeprecatedMethod
+	return s.ExecContext(context.Background(), valueToNamedValue(args))
 }
 
-func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (r driver.Rows, err error) {
+
+	defer func(begin time.Time) {
+		s.conn.observe(ctx, operationQuery, s.query, args, nil, err, begin)
+	}(time.Now())
 
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
@@ -285,16 +356,33 @@ func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows
 	}
 
 	// ============================================
-	queryer, ok := s.base.(driver.StmtQueryContext)
-	if !ok {
-		return nil, ErrUnsupportedMethod
+	if queryer, ok := s.base.(driver.StmtQueryContext); ok {
+		r, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValueToValue(args); err != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		r, err = s.base.Query(values)
+	}
+	if err != nil {
+		return nil, err
 	}
-	rows, err = queryer.QueryContext(ctx, args)
+	r = newRows(ctx, r, time.Now())
 	return
 }
 
 func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
 
+	defer func(begin time.Time) {
+		s.conn.observe(ctx, operationExec, s.query, args, result, err, begin)
+	}(time.Now())
+
 	var parentSpan opentracing.Span
 	var childSpan opentracing.Span
 
@@ -323,10 +411,20 @@ func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (resul
 	}
 
 	// ============================================
-	execer, ok := s.base.(driver.StmtExecContext)
-	if !ok {
-		return nil, ErrUnsupportedMethod
+	if execer, ok := s.base.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+		return
+	}
+
+	var values []driver.Value
+	if values, err = namedValueToValue(args); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
 	}
-	result, err = execer.ExecContext(ctx, args)
+	result, err = s.base.Exec(values)
 	return
 }
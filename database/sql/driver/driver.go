@@ -1,34 +1,152 @@
 package driver
 
 import (
+	"context"
+	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
+var (
+	// ErrDriverNotFound ...
+	ErrDriverNotFound = errors.New("sql base driver is not found")
+)
+
+var (
+	baseDriverMu  sync.RWMutex
+	baseDriverMap = map[string]driver.Driver{
+		"mysql": &mysql.MySQLDriver{},
+	}
+)
+
+// Register makes the base driver dr available by name, so that it can be wrapped.
+// Drivers registered to database/sql are found by name without calling Register.
+func Register(name string, dr driver.Driver) {
+	baseDriverMu.Lock()
+	defer baseDriverMu.Unlock()
+
+	if dr == nil {
+		panic("sky/sql/driver: Register driver is nil")
+	}
+	baseDriverMap[name] = dr
+}
+
 // Driver ...
 type Driver struct {
 	BaseName string
+
+	// Instance is the database instance name used in metrics and logs.
+	Instance string
+	// SlowThreshold is the duration from which a statement is logged to sql.log, 0 disables it.
+	SlowThreshold time.Duration
 }
 
 // Open ...
 func (d Driver) Open(dns string) (driver.Conn, error) {
 	dr := d.getBaseDriver()
+	if dr == nil {
+		return nil, ErrDriverNotFound
+	}
+
 	baseconn, err := dr.Open(dns)
 	if err != nil {
 		return nil, err
 	}
+	return d.wrapConn(baseconn), nil
+}
 
+func (d Driver) wrapConn(baseconn driver.Conn) driver.Conn {
 	c := &conn{
-		base: baseconn,
+		base:   baseconn,
+		driver: d,
+	}
+	return newConn(c)
+}
+
+type connector struct {
+	driver Driver
+	dsn    string
+
+	// base is the connector of the base driver, if it implements driver.DriverContext.
+	baseOnce sync.Once
+	base     driver.Connector
+	baseErr  error
+}
+
+// NewConnector returns a connector of the wrapper Driver d, to be used with sql.OpenDB.
+// The connections are opened by the connector of the base driver, if it implements
+// driver.DriverContext, which parses the dsn only once.
+func NewConnector(d Driver, dsn string) driver.Connector {
+	return &connector{
+		driver: d,
+		dsn:    dsn,
+	}
+}
+
+// Connect ...
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dr := c.driver.getBaseDriver()
+	if dr == nil {
+		return nil, ErrDriverNotFound
+	}
+
+	c.baseOnce.Do(func() {
+		if dc, ok := dr.(driver.DriverContext); ok {
+			c.base, c.baseErr = dc.OpenConnector(c.dsn)
+		}
+	})
+	if c.baseErr != nil {
+		return nil, c.baseErr
+	}
+	if c.base != nil {
+		baseconn, err := c.base.Connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.driver.wrapConn(baseconn), nil
+	}
+
+	// driver.Driver.Open has no context, the connection is dropped if ctx
+	// is done while it's opened.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	baseconn, err := dr.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		baseconn.Close()
+		return nil, err
 	}
-	return c, nil
+	return c.driver.wrapConn(baseconn), nil
+}
+
+// Driver ...
+func (c *connector) Driver() driver.Driver {
+	return c.driver
 }
 
 func (d Driver) getBaseDriver() driver.Driver {
-	switch d.BaseName {
-	case "mysql":
-		return &mysql.MySQLDriver{}
+	baseDriverMu.RLock()
+	dr, ok := baseDriverMap[d.BaseName]
+	baseDriverMu.RUnlock()
+	if ok {
+		return dr
 	}
-	return nil
+
+	// sql.Open does not connect, it only looks up the registered driver.
+	db, err := sql.Open(d.BaseName, "")
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+
+	dr = db.Driver()
+	Register(d.BaseName, dr)
+	return dr
 }
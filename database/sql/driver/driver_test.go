@@ -0,0 +1,208 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestRegisterDriver(t *testing.T) {
+	Register("fake", newFakeDriver())
+	sql.Register("skyfake", &Driver{BaseName: "fake"})
+
+	var ctx = context.Background()
+	db, err := sql.Open("skyfake", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.PingContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.ExecContext(ctx, "SET ?, ?", "key1", "val1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	if err = db.QueryRowContext(ctx, "GET ?", "key1").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "val1" {
+		t.Errorf("db.QueryRowContext = %s; want val1", got)
+	}
+
+	stmt, err := db.PrepareContext(ctx, "GET ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	if err = stmt.QueryRowContext(ctx, "key1").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "val1" {
+		t.Errorf("stmt.QueryRowContext = %s; want val1", got)
+	}
+}
+
+func TestDriverNotFound(t *testing.T) {
+	sql.Register("skynotfound", &Driver{BaseName: "notfound"})
+
+	db, err := sql.Open("skynotfound", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.PingContext(context.Background()); err != ErrDriverNotFound {
+		t.Errorf("db.PingContext = %v; want %v", err, ErrDriverNotFound)
+	}
+}
+
+func TestDriverFromDatabaseSQL(t *testing.T) {
+	sql.Register("fakesql", newFakeDriver())
+	sql.Register("skyfakesql", &Driver{BaseName: "fakesql"})
+
+	db, err := sql.Open("skyfakesql", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.PingContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTxAndRowsTracing(t *testing.T) {
+	Register("faketrace", newFakeDriver())
+	sql.Register("skyfaketrace", &Driver{BaseName: "faketrace"})
+
+	db, err := sql.Open("skyfaketrace", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tracer := mocktracer.New()
+	root := tracer.StartSpan("root")
+	ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.ExecContext(ctx, "SET ?, ?", "key1", "val1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.QueryContext(ctx, "GET ?", "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	spans := map[string]*mocktracer.MockSpan{}
+	for _, span := range tracer.FinishedSpans() {
+		spans[span.OperationName] = span
+	}
+
+	commit, ok := spans["sql.Commit"]
+	if !ok {
+		t.Fatal("sql.Commit span is not found")
+	}
+	if got := commit.Tag("db.tx.isolation"); got != "Serializable" {
+		t.Errorf("sql.Commit db.tx.isolation = %v; want Serializable", got)
+	}
+	if got := commit.Tag("db.tx.read_only"); got != true {
+		t.Errorf("sql.Commit db.tx.read_only = %v; want true", got)
+	}
+
+	rowsSpan, ok := spans["sql.Rows"]
+	if !ok {
+		t.Fatal("sql.Rows span is not found")
+	}
+	if got := rowsSpan.Tag("db.rows"); got != int64(1) {
+		t.Errorf("sql.Rows db.rows = %v; want 1", got)
+	}
+	if got := rowsSpan.Tag("db.rows.eof"); got != true {
+		t.Errorf("sql.Rows db.rows.eof = %v; want true", got)
+	}
+}
+
+type ctxKey struct{}
+
+// fakeContextDriver is a fakeDriver implementing driver.DriverContext, its
+// connector records the values of the contexts to connect with.
+type fakeContextDriver struct {
+	*fakeDriver
+	opened int
+	values []interface{}
+}
+
+func (d *fakeContextDriver) OpenConnector(name string) (driver.Connector, error) {
+	d.opened++
+	return fakeConnector{driver: d, name: name}, nil
+}
+
+type fakeConnector struct {
+	driver *fakeContextDriver
+	name   string
+}
+
+func (c fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.driver.values = append(c.driver.values, ctx.Value(ctxKey{}))
+	return c.driver.Open(c.name)
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func TestConnectorContext(t *testing.T) {
+	base := &fakeContextDriver{fakeDriver: newFakeDriver()}
+	Register("fakectx", base)
+
+	db := sql.OpenDB(NewConnector(Driver{BaseName: "fakectx"}, "fake"))
+	defer db.Close()
+	db.SetMaxIdleConns(0)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v1")
+	for i := 0; i < 2; i++ {
+		if err := db.PingContext(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if base.opened != 1 || len(base.values) != 2 || base.values[0] != "v1" {
+		t.Errorf("base connector opened %d, values %v; want opened once, values [v1 v1]", base.opened, base.values)
+	}
+
+	// The base driver without driver.DriverContext is opened only if ctx is not done.
+	Register("fakenoctx", newFakeDriver())
+	c := NewConnector(Driver{BaseName: "fakenoctx"}, "fake")
+	if conn, err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	} else {
+		conn.Close()
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Connect(cctx); err != context.Canceled {
+		t.Errorf("Connect = %v; want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,159 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// fakeDriver is an in-process driver, every connection shares the same
+// key-value store. The only supported statements are:
+//
+//	SET ?, ?      (exec, set a key to a value)
+//	GET ?         (query, return the value of a key)
+type fakeDriver struct {
+	mu    sync.Mutex
+	store map[string]driver.Value
+}
+
+func newFakeDriver() *fakeDriver {
+	return &fakeDriver{
+		store: map[string]driver.Value{},
+	}
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	if name == "bad" {
+		return nil, errors.New("fake: bad dsn")
+	}
+	return &fakeConn{driver: d}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	closed bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	switch query {
+	case "SET ?, ?":
+		return &fakeStmt{conn: c, query: query, numInput: 2}, nil
+	case "GET ?":
+		return &fakeStmt{conn: c, query: query, numInput: 1}, nil
+	}
+	return nil, errors.New("fake: unsupported query " + query)
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query != "SET ?, ?" || len(args) != 2 {
+		return nil, errors.New("fake: unsupported exec " + query)
+	}
+
+	key, _ := args[0].Value.(string)
+	c.driver.mu.Lock()
+	c.driver.store[key] = args[1].Value
+	c.driver.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if query != "GET ?" || len(args) != 1 {
+		return nil, errors.New("fake: unsupported query " + query)
+	}
+
+	key, _ := args[0].Value.(string)
+	c.driver.mu.Lock()
+	val, ok := c.driver.store[key]
+	c.driver.mu.Unlock()
+
+	rows := &fakeRows{}
+	if ok {
+		rows.values = [][]driver.Value{{val}}
+	}
+	return rows, nil
+}
+
+type fakeStmt struct {
+	conn     *fakeConn
+	query    string
+	numInput int
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return s.numInput
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueToNamedValue(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueToNamedValue(args))
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+	pos    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	maxFingerprintLen = 256
+)
+
+var (
+	fingerprintListRegexp   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintValuesRegexp = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+)
+
+// Fingerprint normalizes query into a statement shape to be used as a metric label.
+// Literals are replaced by `?`, comments are removed, whitespaces are collapsed, lists
+// such as `IN (1, 2, 3)` or `VALUES (...), (...)` are folded into `(?)`, and the result
+// is truncated to 256 bytes.
+func Fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	var last byte = ' '
+	emit := func(c byte) {
+		b.WriteByte(c)
+		last = c
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if last != ' ' {
+				emit(' ')
+			}
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-',
+			c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			if last != ' ' {
+				emit(' ')
+			}
+
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			i += 2
+			for i+1 < len(query) && !(query[i] == '*' && query[i+1] == '/') {
+				i++
+			}
+			i++
+			if last != ' ' {
+				emit(' ')
+			}
+
+		case c == '\'' || c == '"':
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+					continue
+				}
+				if query[i] == c {
+					// A doubled quote is an escaped quote.
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			emit('?')
+
+		case isDigit(c) && !isIdentChar(last):
+			for i+1 < len(query) && (isIdentChar(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			emit('?')
+
+		default:
+			emit(c)
+		}
+	}
+
+	fp := strings.TrimSpace(b.String())
+	fp = fingerprintListRegexp.ReplaceAllString(fp, "(?)")
+	fp = fingerprintValuesRegexp.ReplaceAllString(fp, "(?)")
+	if len(fp) > maxFingerprintLen {
+		fp = fp[:maxFingerprintLen]
+	}
+	return fp
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,24 @@
+package driver
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 'OK'", "SELECT ?"},
+		{"SELECT * FROM t1 WHERE id = 10", "SELECT * FROM t1 WHERE id = ?"},
+		{"SELECT *\n\tFROM  t WHERE name = 'it''s' AND x = \"a\\\"b\"", "SELECT * FROM t WHERE name = ? AND x = ?"},
+		{"SELECT * FROM t WHERE id IN (1, 2, 3)", "SELECT * FROM t WHERE id IN (?)"},
+		{"SELECT * FROM t WHERE id IN (?,?,?)", "SELECT * FROM t WHERE id IN (?)"},
+		{"INSERT INTO t(a, b) VALUES (1, 'x'), (2, 'y')", "INSERT INTO t(a, b) VALUES (?)"},
+		{"SELECT a -- comment\nFROM t /* hint */ WHERE b = 1.5", "SELECT a FROM t WHERE b = ?"},
+	}
+
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+)
+
+const (
+	operationQuery   = "query"
+	operationExec    = "exec"
+	operationPrepare = "prepare"
+	operationBegin   = "begin"
+)
+
+// observe records the metrics of a sql request, and logs it to sql.log if it's slow.
+func (c *conn) observe(ctx context.Context, operation string, query string, args []driver.NamedValue, result driver.Result, err error, begin time.Time) {
+	if err == driver.ErrSkip {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	statement := Fingerprint(query)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	skyprome.DBClientRequestsTotalCounter(c.driver.Instance, operation, statement, status)
+	skyprome.DBClientRequestsDurationHistogram(c.driver.Instance, operation, statement, elapsed.Seconds())
+
+	if c.driver.SlowThreshold <= 0 || elapsed < c.driver.SlowThreshold {
+		return
+	}
+
+	var rowsAffected interface{}
+	if result != nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			rowsAffected = n
+		}
+	}
+
+	log.Warnw(ctx, fmt.Sprintf("slow sql %s", operation), log.TypeKey, log.TypeValSQL, "instance", c.driver.Instance,
+		"statement", query, "args", redactArgs(args), "rows_affected", rowsAffected, "caller", caller(),
+		"request_time", fmt.Sprintf("%.3f", float32(elapsed.Microseconds())/1000), "err", err)
+}
+
+// redactArgs keeps the type of every argument, but hides the content of strings and bytes.
+func redactArgs(args []driver.NamedValue) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.Value.(type) {
+		case nil:
+			redacted[i] = "NULL"
+		case string:
+			redacted[i] = fmt.Sprintf("<string len=%d>", len(v))
+		case []byte:
+			redacted[i] = fmt.Sprintf("<bytes len=%d>", len(v))
+		case time.Time:
+			redacted[i] = v.Format(time.RFC3339Nano)
+		case int64, float64, bool:
+			redacted[i] = fmt.Sprint(v)
+		default:
+			redacted[i] = fmt.Sprintf("<%T>", v)
+		}
+	}
+	return redacted
+}
+
+// caller returns the first caller outside of database/sql and the database packages of go-sky.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "database/sql.") &&
+			!strings.HasPrefix(frame.Function, "github.com/WiFeng/go-sky/database") {
+			dir, file := filepath.Split(frame.File)
+			return fmt.Sprintf("%s/%s:%d", filepath.Base(dir), file, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+// The wrapper conn always implements the context interfaces, falling back to
+// the legacy methods of the base conn or to driver.ErrSkip as database/sql does.
+// The interfaces without such a fallback are exposed only if the base conn or
+// stmt implements them, by composing the types below.
+
+type sessionResetter struct {
+	resetter driver.SessionResetter
+}
+
+func (r sessionResetter) ResetSession(ctx context.Context) error {
+	return r.resetter.ResetSession(ctx)
+}
+
+type validator struct {
+	validator driver.Validator
+}
+
+func (v validator) IsValid() bool {
+	return v.validator.IsValid()
+}
+
+type namedValueChecker struct {
+	checker driver.NamedValueChecker
+}
+
+func (n namedValueChecker) CheckNamedValue(nv *driver.NamedValue) error {
+	return n.checker.CheckNamedValue(nv)
+}
+
+type columnConverter struct {
+	converter driver.ColumnConverter
+}
+
+func (c columnConverter) ColumnConverter(idx int) driver.ValueConverter {
+	return c.converter.ColumnConverter(idx)
+}
+
+// newConn returns c with exactly the optional interfaces of its base conn.
+func newConn(c *conn) driver.Conn {
+	r, hasR := c.base.(driver.SessionResetter)
+	v, hasV := c.base.(driver.Validator)
+	n, hasN := c.base.(driver.NamedValueChecker)
+
+	switch {
+	case hasR && hasV && hasN:
+		return struct {
+			*conn
+			sessionResetter
+			validator
+			namedValueChecker
+		}{c, sessionResetter{r}, validator{v}, namedValueChecker{n}}
+	case hasR && hasV:
+		return struct {
+			*conn
+			sessionResetter
+			validator
+		}{c, sessionResetter{r}, validator{v}}
+	case hasR && hasN:
+		return struct {
+			*conn
+			sessionResetter
+			namedValueChecker
+		}{c, sessionResetter{r}, namedValueChecker{n}}
+	case hasV && hasN:
+		return struct {
+			*conn
+			validator
+			namedValueChecker
+		}{c, validator{v}, namedValueChecker{n}}
+	case hasR:
+		return struct {
+			*conn
+			sessionResetter
+		}{c, sessionResetter{r}}
+	case hasV:
+		return struct {
+			*conn
+			validator
+		}{c, validator{v}}
+	case hasN:
+		return struct {
+			*conn
+			namedValueChecker
+		}{c, namedValueChecker{n}}
+	}
+	return c
+}
+
+// newStmt returns s with exactly the optional interfaces of its base stmt.
+func newStmt(s *stmt) driver.Stmt {
+	n, hasN := s.base.(driver.NamedValueChecker)
+	cc, hasC := s.base.(driver.ColumnConverter)
+
+	switch {
+	case hasN && hasC:
+		return struct {
+			*stmt
+			namedValueChecker
+			columnConverter
+		}{s, namedValueChecker{n}, columnConverter{cc}}
+	case hasN:
+		return struct {
+			*stmt
+			namedValueChecker
+		}{s, namedValueChecker{n}}
+	case hasC:
+		return struct {
+			*stmt
+			columnConverter
+		}{s, columnConverter{cc}}
+	}
+	return s
+}
+
+// begin is the fallback of BeginTx for a base conn without driver.ConnBeginTx.
+func (c *conn) begin(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.Isolation != 0 {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+
+	t, err := c.base.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Rollback()
+		return nil, ctx.Err()
+	default:
+	}
+	return t, nil
+}
+
+// prepare is the fallback of PrepareContext for a base conn without driver.ConnPrepareContext.
+func (c *conn) prepare(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.base.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		s.Close()
+		return nil, ctx.Err()
+	default:
+	}
+	return s, nil
+}
+
+func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
+
+func valueToNamedValue(values []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
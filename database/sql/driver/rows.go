@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// rows counts the rows read and the time spent until the last one.
+// The optional column type interfaces fall back to the defaults of database/sql.
+type rows struct {
+	base  driver.Rows
+	span  opentracing.Span
+	begin time.Time
+
+	count    int64
+	lastRow  time.Duration
+	finished bool
+}
+
+func newRows(ctx context.Context, base driver.Rows, begin time.Time) *rows {
+	return &rows{
+		base:  base,
+		span:  startSpan(ctx, "sql.Rows"),
+		begin: begin,
+	}
+}
+
+func (r *rows) Columns() []string {
+	return r.base.Columns()
+}
+
+func (r *rows) Close() (err error) {
+	err = r.base.Close()
+
+	if r.span != nil {
+		if !r.finished {
+			r.lastRow = time.Since(r.begin)
+		}
+		r.span.SetTag("db.rows", r.count)
+		r.span.SetTag("db.rows.eof", r.finished)
+		r.span.SetTag("db.rows.time_to_last_row_ms", float64(r.lastRow.Microseconds())/1000)
+		finishSpan(r.span, err)
+		r.span = nil
+	}
+	return
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.base.Next(dest)
+	switch err {
+	case nil:
+		r.count++
+	case io.EOF:
+		if !r.finished {
+			r.finished = true
+			r.lastRow = time.Since(r.begin)
+		}
+	}
+	return err
+}
+
+func (r *rows) HasNextResultSet() bool {
+	if rs, ok := r.base.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *rows) NextResultSet() error {
+	if rs, ok := r.base.(driver.RowsNextResultSet); ok {
+		r.finished = false
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if rs, ok := r.base.(driver.RowsColumnTypeScanType); ok {
+		return rs.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if rs, ok := r.base.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rs.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if rs, ok := r.base.(driver.RowsColumnTypeLength); ok {
+		return rs.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if rs, ok := r.base.(driver.RowsColumnTypeNullable); ok {
+		return rs.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if rs, ok := r.base.(driver.RowsColumnTypePrecisionScale); ok {
+		return rs.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
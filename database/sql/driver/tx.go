@@ -0,0 +1,89 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	operationCommit   = "commit"
+	operationRollback = "rollback"
+)
+
+// tx traces Commit and Rollback with the context and options passed to BeginTx.
+type tx struct {
+	base driver.Tx
+	conn *conn
+	ctx  context.Context
+	opts driver.TxOptions
+}
+
+func (t *tx) Commit() (err error) {
+	defer func(begin time.Time) {
+		t.conn.observe(t.ctx, operationCommit, "", nil, nil, err, begin)
+	}(time.Now())
+
+	span := startSpan(t.ctx, "sql.Commit", txTags(t.opts)...)
+	defer func() {
+		finishSpan(span, err)
+	}()
+
+	err = t.base.Commit()
+	return
+}
+
+func (t *tx) Rollback() (err error) {
+	defer func(begin time.Time) {
+		t.conn.observe(t.ctx, operationRollback, "", nil, nil, err, begin)
+	}(time.Now())
+
+	span := startSpan(t.ctx, "sql.Rollback", txTags(t.opts)...)
+	defer func() {
+		finishSpan(span, err)
+	}()
+
+	err = t.base.Rollback()
+	return
+}
+
+func txTags(opts driver.TxOptions) []opentracing.Tag {
+	return []opentracing.Tag{
+		{Key: "db.tx.isolation", Value: sql.IsolationLevel(opts.Isolation).String()},
+		{Key: "db.tx.read_only", Value: opts.ReadOnly},
+	}
+}
+
+// startSpan starts a child span of the span in ctx, it returns nil if there is none.
+func startSpan(ctx context.Context, operationName string, tags ...opentracing.Tag) opentracing.Span {
+	parentSpan := opentracing.SpanFromContext(ctx)
+	if parentSpan == nil {
+		return nil
+	}
+
+	opts := []opentracing.StartSpanOption{
+		opentracing.ChildOf(parentSpan.Context()),
+		opentracing.Tag{Key: string(opentracingext.DBType), Value: "sql"},
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "database"},
+		opentracingext.SpanKindRPCClient,
+	}
+	for _, tag := range tags {
+		opts = append(opts, tag)
+	}
+	return parentSpan.Tracer().StartSpan(operationName, opts...)
+}
+
+func finishSpan(span opentracing.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		opentracingext.Error.Set(span, true)
+		span.SetTag("db.error", err.Error())
+	}
+	span.Finish()
+}
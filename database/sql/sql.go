@@ -2,16 +2,22 @@ package sql
 
 import (
 	"database/sql"
+	sqldriver "database/sql/driver"
+	"sync"
 
 	"github.com/WiFeng/go-sky/database/sql/driver"
 )
 
 var (
+	driverMu  sync.Mutex
 	driverMap = make(map[string]*driver.Driver)
 )
 
 // Register register wrapper Driver and return the new wrapper DriverName
 func Register(driverName string) string {
+	driverMu.Lock()
+	defer driverMu.Unlock()
+
 	dn := "sky" + driverName
 
 	if _, ok := driverMap[dn]; ok {
@@ -25,3 +31,10 @@ func Register(driverName string) string {
 	sql.Register(dn, dr)
 	return dn
 }
+
+// RegisterDriver register the base driver dr by driverName, then register
+// the wrapper Driver and return the new wrapper DriverName
+func RegisterDriver(driverName string, dr sqldriver.Driver) string {
+	driver.Register(driverName, dr)
+	return Register(driverName)
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+	"github.com/go-sql-driver/mysql"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrLockDeadlock    = 1213
+
+	pgErrSerializationFailure = "40001"
+	pgErrDeadlockDetected     = "40P01"
+)
+
+// WithTx runs fn in a transaction on the primary of the database instance. The
+// transaction is committed if fn returns nil, and rolled back if fn returns an
+// error or panics, in which case the panic goes on after the rollback. The whole
+// transaction is run again with backoff if it fails with an error classified by
+// IsRetryable, up to TxMaxAttempts times, so fn must be safe to run again.
+func WithTx(ctx context.Context, instanceName string, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	db, err := GetInstance(ctx, instanceName)
+	if err != nil {
+		return err
+	}
+
+	cf := dbConfig[instanceName]
+	maxAttempts := cf.TxMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 3
+	}
+	backoff := cf.TxRetryBackoffMillSec * time.Millisecond
+	if backoff <= 0 {
+		backoff = 50 * time.Millisecond
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry := attempt < maxAttempts
+		if err = runTx(ctx, db, instanceName, attempt, retry, opts, fn); err == nil {
+			return nil
+		}
+		if !retry || !IsRetryable(err) {
+			return err
+		}
+
+		// Jitter the backoff, so that the transactions in a deadlock do not meet again.
+		wait := time.Duration(rand.Int63n(int64(backoff))) + backoff/2
+		log.Warnw(ctx, "database transaction retry", "instance", instanceName, "attempt", attempt, "wait", wait.String(), "err", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// runTx runs one attempt of WithTx. retry tells whether a retryable error is going to be retried.
+func runTx(ctx context.Context, db *sql.DB, instance string, attempt int, retry bool, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	var span opentracing.Span
+	if parentSpan := opentracing.SpanFromContext(ctx); parentSpan != nil {
+		span = parentSpan.Tracer().StartSpan(
+			"sql.WithTx",
+			opentracing.ChildOf(parentSpan.Context()),
+			opentracing.Tag{Key: string(opentracingext.DBType), Value: "sql"},
+			opentracing.Tag{Key: string(opentracingext.DBInstance), Value: instance},
+			opentracing.Tag{Key: "db.tx.attempt", Value: attempt},
+			opentracing.Tag{Key: string(opentracingext.Component), Value: "database"},
+			opentracingext.SpanKindRPCClient,
+		)
+		ctx = opentracing.ContextWithSpan(ctx, span)
+	}
+
+	var status = "commit"
+	defer func(begin time.Time) {
+		panicErr := recover()
+		if panicErr != nil {
+			status = "panic"
+			err = fmt.Errorf("database transaction panic: %v", panicErr)
+		} else if err != nil && status != "begin" {
+			status = "rollback"
+			if retry && IsRetryable(err) {
+				status = "retry"
+			}
+		}
+
+		skyprome.DBClientTxAttemptTotalCounter(instance, status)
+		skyprome.DBClientTxDurationHistogram(instance, status, time.Since(begin).Seconds())
+
+		if span != nil {
+			span.SetTag("db.tx.status", status)
+			if err != nil {
+				opentracingext.Error.Set(span, true)
+				span.SetTag("db.error", err.Error())
+			}
+			span.Finish()
+		}
+
+		if panicErr != nil {
+			panic(panicErr)
+		}
+	}(time.Now())
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		status = "begin"
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+				log.Warnw(ctx, "database transaction rollback error", "instance", instance, "err", rerr)
+			}
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	committed = true
+	return tx.Commit()
+}
+
+// IsRetryable reports whether err is a transient error of a transaction, which
+// is likely to succeed if the transaction is run again: deadlocks and lock wait
+// timeouts of MySQL, and serialization failures and deadlocks of PostgreSQL.
+func IsRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrLockDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+
+	// Implemented by the errors of pgx and lib/pq.
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		state := stateErr.SQLState()
+		return state == pgErrSerializationFailure || state == pgErrDeadlockDetected
+	}
+
+	return false
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type testStateError string
+
+func (e testStateError) Error() string {
+	return "state " + string(e)
+}
+
+func (e testStateError) SQLState() string {
+	return string(e)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1213}), true},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{testStateError("40001"), true},
+		{testStateError("40P01"), true},
+		{testStateError("23505"), false},
+		{sql.ErrNoRows, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	var ctx = context.Background()
+	db, err := GetInstance(ctx, testSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.ExecContext(ctx, "CREATE TABLE tx_user (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(tx *sql.Tx, id int) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO tx_user (id, name) VALUES (?, ?)", id, "a")
+		return err
+	}
+	count := func() (n int) {
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tx_user").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// The first attempt is rolled back, and the transaction is run again.
+	var attempts int
+	err = WithTx(ctx, testSQLite, nil, func(tx *sql.Tx) error {
+		attempts++
+		if err := insert(tx, 1); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			return &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("WithTx = %v, attempts %d; want nil, attempts 2", err, attempts)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("rows = %d; want 1", n)
+	}
+
+	errNotRetryable := errors.New("not retryable")
+	attempts = 0
+	err = WithTx(ctx, testSQLite, nil, func(tx *sql.Tx) error {
+		attempts++
+		if err := insert(tx, 2); err != nil {
+			return err
+		}
+		return errNotRetryable
+	})
+	if err != errNotRetryable || attempts != 1 {
+		t.Errorf("WithTx = %v, attempts %d; want %v, attempts 1", err, attempts, errNotRetryable)
+	}
+
+	// The retryable error is returned after TxMaxAttempts, 3 by default.
+	attempts = 0
+	err = WithTx(ctx, testSQLite, nil, func(tx *sql.Tx) error {
+		attempts++
+		return &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+	})
+	if !IsRetryable(err) || attempts != 3 {
+		t.Errorf("WithTx = %v, attempts %d; want retryable, attempts 3", err, attempts)
+	}
+
+	// The panic goes on after the rollback.
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("WithTx recover = %v; want boom", r)
+			}
+		}()
+		WithTx(ctx, testSQLite, nil, func(tx *sql.Tx) error {
+			if err := insert(tx, 3); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	if n := count(); n != 1 {
+		t.Errorf("rows = %d; want 1 after the rollbacks", n)
+	}
+}
@@ -0,0 +1,204 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WiFeng/go-sky/helper"
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+var (
+	// ErrBulkIndexerExists ...
+	ErrBulkIndexerExists = errors.New("elasticsearch bulk indexer of the name exists")
+)
+
+// BulkIndexerOptions ...
+type BulkIndexerOptions struct {
+	// Name labels the metrics of the indexer, it's Index or `default` if not set.
+	// It must be unique among the open indexers of the instance.
+	Name string
+
+	// Index is the default index of the items.
+	Index string
+
+	NumWorkers    int           // runtime.NumCPU() by default
+	FlushBytes    int           // 5MB by default
+	FlushInterval time.Duration // 30s by default
+
+	Pipeline string
+	Refresh  string
+	Routing  string
+	Timeout  time.Duration
+
+	// OnFailure is called for every failed item, after it's logged.
+	OnFailure func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error)
+	// OnError is called for the errors of the indexer, e.g. a failed flush, after it's logged.
+	// The items of a failed flush are not passed to OnFailure.
+	OnError func(ctx context.Context, err error)
+}
+
+// BulkIndexer is an esutil.BulkIndexer on the elasticsearch instance. The items
+// are flushed by size or interval, and Add blocks if the workers are busy.
+// It's closed, which flushes the pending items, when the process runs its defer functions.
+type BulkIndexer struct {
+	esutil.BulkIndexer
+
+	instance string
+	name     string
+	opts     BulkIndexerOptions
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type bulkContextKey int
+
+const (
+	bulkFlushContext bulkContextKey = iota
+)
+
+// bulkFlush is the state of a flush in its context. A flush may fail before its
+// request is sent, so only the flushes sending a request are reported, and the
+// spans of the others are tagged bulk.requested=false.
+type bulkFlush struct {
+	begin     time.Time
+	span      opentracing.Span
+	requested int32
+}
+
+// markBulkRequest marks the flush of ctx, if any, as sending a request.
+func markBulkRequest(ctx context.Context) {
+	if f, ok := ctx.Value(bulkFlushContext).(*bulkFlush); ok {
+		atomic.StoreInt32(&f.requested, 1)
+	}
+}
+
+// NewBulkIndexer returns a bulk indexer on the elasticsearch instance `name`.
+func NewBulkIndexer(ctx context.Context, name string, opts BulkIndexerOptions) (*BulkIndexer, error) {
+	cl, err := GetInstance(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Name == "" {
+		opts.Name = opts.Index
+	}
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+
+	b := &BulkIndexer{
+		instance: name,
+		name:     opts.Name,
+		opts:     opts,
+	}
+
+	b.BulkIndexer, err = esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        cl,
+		Index:         opts.Index,
+		NumWorkers:    opts.NumWorkers,
+		FlushBytes:    opts.FlushBytes,
+		FlushInterval: opts.FlushInterval,
+		Pipeline:      opts.Pipeline,
+		Refresh:       opts.Refresh,
+		Routing:       opts.Routing,
+		Timeout:       opts.Timeout,
+		OnError:       b.onError,
+		OnFlushStart:  b.onFlushStart,
+		OnFlushEnd:    b.onFlushEnd,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !skyprome.RegisterESBulkIndexerStats(name, opts.Name, b.BulkIndexer.Stats) {
+		b.BulkIndexer.Close(ctx)
+		log.Errorw(ctx, "elasticsearch.NewBulkIndexer error", "instance", name, "indexer", opts.Name, "err", ErrBulkIndexerExists)
+		return nil, ErrBulkIndexerExists
+	}
+	helper.AddDeferFunc(func() {
+		if err := b.Close(context.Background()); err != nil {
+			log.Errorw(context.Background(), "elasticsearch bulk indexer close error", "instance", name, "indexer", opts.Name, "err", err)
+		}
+	})
+
+	return b, nil
+}
+
+// Add adds the item to the indexer, the failure of the item is logged and
+// passed to OnFailure of the options, as well as OnFailure of the item.
+func (b *BulkIndexer) Add(ctx context.Context, item esutil.BulkIndexerItem) error {
+	onFailure := item.OnFailure
+	item.OnFailure = func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		log.Errorw(ctx, "elasticsearch bulk item error", "instance", b.instance, "indexer", b.name,
+			"index", res.Index, "action", item.Action, "document_id", item.DocumentID, "status", res.Status,
+			"error_type", res.Error.Type, "error_reason", res.Error.Reason, "err", err)
+
+		if b.opts.OnFailure != nil {
+			b.opts.OnFailure(ctx, item, res, err)
+		}
+		if onFailure != nil {
+			onFailure(ctx, item, res, err)
+		}
+	}
+	return b.BulkIndexer.Add(ctx, item)
+}
+
+// Close flushes the pending items and stops the workers, it can be called more than once.
+func (b *BulkIndexer) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		b.closeErr = b.BulkIndexer.Close(ctx)
+		skyprome.UnregisterESBulkIndexerStats(b.instance, b.name)
+
+		stats := b.BulkIndexer.Stats()
+		log.Infow(ctx, "elasticsearch bulk indexer closed", "instance", b.instance, "indexer", b.name,
+			"added", stats.NumAdded, "flushed", stats.NumFlushed, "failed", stats.NumFailed, "requests", stats.NumRequests)
+	})
+	return b.closeErr
+}
+
+func (b *BulkIndexer) onError(ctx context.Context, err error) {
+	log.Errorw(ctx, "elasticsearch bulk indexer error", "instance", b.instance, "indexer", b.name, "err", err)
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		opentracingext.Error.Set(span, true)
+		span.SetTag("bulk.error", err.Error())
+	}
+
+	if b.opts.OnError != nil {
+		b.opts.OnError(ctx, err)
+	}
+}
+
+// onFlushStart starts the span of the flush, so that the bulk request is its child.
+func (b *BulkIndexer) onFlushStart(ctx context.Context) context.Context {
+	span := opentracing.GlobalTracer().StartSpan(
+		"elasticsearch.BulkIndexer.Flush",
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "elasticsearch"},
+		opentracing.Tag{Key: "db.instance", Value: b.instance},
+		opentracing.Tag{Key: "bulk.indexer", Value: b.name},
+	)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	return context.WithValue(ctx, bulkFlushContext, &bulkFlush{begin: time.Now(), span: span})
+}
+
+func (b *BulkIndexer) onFlushEnd(ctx context.Context) {
+	f, ok := ctx.Value(bulkFlushContext).(*bulkFlush)
+	if !ok {
+		return
+	}
+
+	if atomic.LoadInt32(&f.requested) == 0 {
+		f.span.SetTag("bulk.requested", false)
+	} else {
+		skyprome.ESBulkIndexerFlushDurationHistogram(b.instance, b.name, time.Since(f.begin).Seconds())
+	}
+	f.span.Finish()
+}
@@ -2,7 +2,13 @@ package elasticsearch
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
 
 	"github.com/WiFeng/go-sky/config"
 	skyhttp "github.com/WiFeng/go-sky/http"
@@ -18,44 +24,176 @@ var (
 var (
 	// ErrConfigNotFound ...
 	ErrConfigNotFound = errors.New("elasticsearch config is not found")
+	// ErrAddrsWithCloudID ...
+	ErrAddrsWithCloudID = errors.New("elasticsearch addrs and cloud id are both set")
+	// ErrAPIKeyWithPassword ...
+	ErrAPIKeyWithPassword = errors.New("elasticsearch api key and username/password are both set")
+	// ErrInvalidMaxRetries ...
+	ErrInvalidMaxRetries = errors.New("elasticsearch max retries is negative")
+	// ErrInvalidRetryOnStatus ...
+	ErrInvalidRetryOnStatus = errors.New("elasticsearch retry on status is not a http status code")
+	// ErrInvalidCAFile ...
+	ErrInvalidCAFile = errors.New("elasticsearch tls ca file has no certificate")
 )
 
+// infoTimeout is the timeout of the startup cluster info check.
+const infoTimeout = 5 * time.Second
+
 // Init ...
 func Init(ctx context.Context, serviceName string, cfs []config.Elasticsearch) {
 
 	for _, cf := range cfs {
 		esConfig[cf.Name] = cf
 
-		var cl *elasticsearch.Client
-		var err error
-		{
-			tr := skyhttp.NewRoundTripperFromConfig(cf.Transport)
-			tr.Use(RoundTripperTracingMiddleware)
+		// Dont show passwd in log
+		logCf := cf
+		logCf.Password = "dont show me!"
+		logCf.APIKey = "dont show me!"
+
+		if err := validate(cf); err != nil {
+			log.Fatalw(ctx, "elasticsearch config error", "conf", logCf, "err", err)
+			continue
+		}
 
-			esCfg := elasticsearch.Config{
-				Addresses: cf.Addrs,
-				Username:  cf.Username,
-				Password:  cf.Password,
-				Transport: tr,
-			}
+		cl, err := newClient(cf)
+		if err != nil {
+			log.Fatalw(ctx, "elasticsearch.NewClient error", "conf", logCf, "err", err)
+			continue
+		}
 
-			if cl, err = elasticsearch.NewClient(esCfg); err != nil {
-				log.Fatalw(ctx, "elasticsearch.NewClient error", "conf", cf, "err", err)
-				continue
-			}
+		info, err := clusterInfo(ctx, cl)
+		if err != nil {
+			log.Fatalw(ctx, "elasticsearch info error", "name", cf.Name, "addrs", cf.Addrs, "err", err)
+			continue
 		}
 
-		log.Infof(ctx, "Init elasticsearch [%s] %+v", cf.Name, cf)
+		log.Infof(ctx, "Init elasticsearch [%s] %+v, cluster %s, version %s", cf.Name, logCf, info.ClusterName, info.Version.Number)
 		esMap[cf.Name] = cl
 	}
 }
 
+func validate(cf config.Elasticsearch) error {
+	if len(cf.Addrs) > 0 && cf.CloudID != "" {
+		return ErrAddrsWithCloudID
+	}
+	if cf.APIKey != "" && (cf.Username != "" || cf.Password != "") {
+		return ErrAPIKeyWithPassword
+	}
+	if cf.MaxRetries < 0 {
+		return ErrInvalidMaxRetries
+	}
+	for _, code := range cf.RetryOnStatus {
+		if code < 100 || code > 599 {
+			return ErrInvalidRetryOnStatus
+		}
+	}
+	return nil
+}
+
+func newClient(cf config.Elasticsearch) (*elasticsearch.Client, error) {
+	trCf := cf.Transport
+	trCf.Customized = trCf.Customized || cf.CustomTranport
+
+	// The ca is set to the transport, since the client accepts it only
+	// if the transport is a *http.Transport.
+	base := skyhttp.NewTransport(trCf)
+	if cf.TLSCAFile != "" || cf.TLSSkipVerify {
+		tlsConfig, err := newTLSConfig(cf)
+		if err != nil {
+			return nil, err
+		}
+		base.TLSClientConfig = tlsConfig
+	}
+
+	tr := skyhttp.NewRoundTripper(base)
+	tr.Use(RoundTripperTracingMiddleware, NewRoundTripperLoggingMiddleware(cf.Name), NewRoundTripperMetricsMiddleware(cf.Name))
+	if cf.CompressRequestBody {
+		tr.Use(RoundTripperGzipMiddleware)
+	}
+
+	esCfg := elasticsearch.Config{
+		Addresses: cf.Addrs,
+		Username:  cf.Username,
+		Password:  cf.Password,
+		CloudID:   cf.CloudID,
+		APIKey:    cf.APIKey,
+
+		RetryOnStatus:        cf.RetryOnStatus,
+		DisableRetry:         cf.DisableRetry,
+		EnableRetryOnTimeout: cf.EnableRetryOnTimeout,
+		MaxRetries:           cf.MaxRetries,
+
+		DiscoverNodesOnStart:  cf.DiscoverNodesOnStart,
+		DiscoverNodesInterval: cf.DiscoverNodesIntervalSec * time.Second,
+
+		Transport: tr,
+	}
+
+	if backoff := cf.RetryBackoffMillSec * time.Millisecond; backoff > 0 {
+		esCfg.RetryBackoff = func(attempt int) time.Duration {
+			return time.Duration(attempt) * backoff
+		}
+	}
+
+	return elasticsearch.NewClient(esCfg)
+}
+
+func newTLSConfig(cf config.Elasticsearch) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cf.TLSSkipVerify,
+	}
+
+	if cf.TLSCAFile != "" {
+		ca, err := ioutil.ReadFile(cf.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, ErrInvalidCAFile
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+type info struct {
+	ClusterName string `json:"cluster_name"`
+	Version     struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+// clusterInfo checks the connectivity of the cluster, as the ping of the other instances.
+func clusterInfo(ctx context.Context, cl *elasticsearch.Client) (*info, error) {
+	ctx, cancel := context.WithTimeout(ctx, infoTimeout)
+	defer cancel()
+
+	res, err := cl.Info(cl.Info.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch info: %s", res.Status())
+	}
+
+	var i info
+	if err = json.NewDecoder(res.Body).Decode(&i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
 // GetInstance ...
 func GetInstance(ctx context.Context, instanceName string) (*elasticsearch.Client, error) {
 	es, ok := esMap[instanceName]
 	if !ok {
 		err := ErrConfigNotFound
-		log.Errorw(ctx, "redis.GetInstance, instanceName is not in esMap map", "instance_name", instanceName, "err", err)
+		log.Errorw(ctx, "elasticsearch.GetInstance, instanceName is not in esMap map", "instance_name", instanceName, "err", err)
 		return nil, err
 	}
 	return es, nil
@@ -1,11 +1,21 @@
 package elasticsearch
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	skyhttp "github.com/WiFeng/go-sky/http"
 	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
 	kitopentracing "github.com/go-kit/kit/tracing/opentracing"
 	"github.com/opentracing/opentracing-go"
 	opentracingext "github.com/opentracing/opentracing-go/ext"
@@ -58,3 +68,206 @@ func RoundTripperTracingMiddleware(next http.RoundTripper) http.RoundTripper {
 		return
 	})
 }
+
+// NewRoundTripperLoggingMiddleware logs every request of the instance to elasticsearch.log,
+// with the index, the operation, the took of the response and the truncated request body.
+func NewRoundTripperLoggingMiddleware(instance string) skyhttp.RoundTripperMiddlewareFunc {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return skyhttp.RoundTripperFunc(func(req *http.Request) (resp *http.Response, err error) {
+			var ctx = req.Context()
+			var reqBody []byte
+
+			// Only peek the body, the bulk requests may be large.
+			if req.Body != nil && req.Body != http.NoBody {
+				br := bufio.NewReaderSize(req.Body, maxLogBodyLen)
+				reqBody, _ = br.Peek(maxLogBodyLen)
+				reqBody = append([]byte(nil), reqBody...)
+				req.Body = readCloser{br, req.Body}
+			}
+
+			defer func(begin time.Time) {
+				var respStatus int
+				var took = -1
+
+				if err == context.Canceled {
+					respStatus = 499
+				}
+
+				if resp != nil {
+					respStatus = resp.StatusCode
+					if resp.Body != nil {
+						br := bufio.NewReaderSize(resp.Body, 64)
+						head, _ := br.Peek(64)
+						took = parseTook(head)
+						resp.Body = readCloser{br, resp.Body}
+					}
+				}
+
+				index, operation := parseRequest(req.Method, req.URL.Path)
+				keysAndValues := []interface{}{log.TypeKey, log.TypeValElasticsearch, "instance", instance,
+					"index", index, "method", req.Method, "path", req.URL.Path, "query", req.URL.RawQuery,
+					"req", string(reqBody), "status", respStatus, "took", took,
+					"request_time", fmt.Sprintf("%.3f", float32(time.Since(begin).Microseconds())/1000), "err", err}
+
+				if err != nil || respStatus >= 500 {
+					log.Errorw(ctx, operation, keysAndValues...)
+					return
+				}
+				log.Infow(ctx, operation, keysAndValues...)
+			}(time.Now())
+
+			resp, err = next.RoundTrip(req)
+			return
+		})
+	}
+}
+
+// NewRoundTripperMetricsMiddleware records the es_client_* metrics of every request of the instance.
+func NewRoundTripperMetricsMiddleware(instance string) skyhttp.RoundTripperMiddlewareFunc {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return skyhttp.RoundTripperFunc(func(req *http.Request) (resp *http.Response, err error) {
+			markBulkRequest(req.Context())
+
+			defer func(begin time.Time) {
+				var respStatus int
+
+				if err == context.Canceled {
+					respStatus = 499
+				}
+
+				if resp != nil {
+					respStatus = resp.StatusCode
+				}
+
+				_, operation := parseRequest(req.Method, req.URL.Path)
+				duration := float64(time.Since(begin).Microseconds()) / 1000000
+
+				skyprome.ESClientRequestsTotalCounter(instance, operation, respStatus)
+				skyprome.ESClientRequestsDurationHistogram(instance, operation, duration)
+			}(time.Now())
+
+			resp, err = next.RoundTrip(req)
+			return
+		})
+	}
+}
+
+// RoundTripperGzipMiddleware compresses the request bodies with gzip,
+// which is supported by elasticsearch if http.compression is enabled.
+func RoundTripperGzipMiddleware(next http.RoundTripper) http.RoundTripper {
+	return skyhttp.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+			return next.RoundTrip(req)
+		}
+
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := io.Copy(zw, req.Body)
+		req.Body.Close()
+		if err == nil {
+			err = zw.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		body := buf.Bytes()
+		req = req.Clone(req.Context())
+		req.Header.Set("Content-Encoding", "gzip")
+		req.ContentLength = int64(len(body))
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// maxLogBodyLen is the max length of the request body in the log.
+const maxLogBodyLen = 800
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// parseRequest returns the index and the operation of the request from its path,
+// e.g. search, bulk, index and get. The operation is used as a metric label,
+// so it's one of the api names rather than the raw path.
+func parseRequest(method string, path string) (index string, operation string) {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		return "", "info"
+	}
+
+	api := -1
+	for i, s := range segments {
+		if strings.HasPrefix(s, "_") {
+			api = i
+			break
+		}
+	}
+	if api != 0 {
+		index = segments[0]
+	}
+
+	// Without api, it's /{index} or the legacy /{index}/{type}/{id}.
+	if api < 0 {
+		if len(segments) == 1 {
+			return index, "indices"
+		}
+		return index, docOperation(method)
+	}
+
+	switch name := strings.TrimPrefix(segments[api], "_"); name {
+	case "doc":
+		return index, docOperation(method)
+	case "create":
+		return index, "index"
+	case "source":
+		return index, "get"
+	case "search":
+		if api+1 < len(segments) && segments[api+1] == "scroll" {
+			return index, "scroll"
+		}
+		return index, "search"
+	default:
+		return index, name
+	}
+}
+
+func docOperation(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "get"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "index"
+	}
+}
+
+// parseTook returns the took of the response from its head, -1 if it's not found.
+func parseTook(head []byte) int {
+	i := bytes.Index(head, []byte(`"took":`))
+	if i < 0 {
+		return -1
+	}
+
+	head = head[i+len(`"took":`):]
+	end := 0
+	for end < len(head) && head[end] >= '0' && head[end] <= '9' {
+		end++
+	}
+
+	took, err := strconv.Atoi(string(head[:end]))
+	if err != nil {
+		return -1
+	}
+	return took
+}
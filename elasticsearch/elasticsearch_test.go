@@ -1,24 +1,87 @@
 package elasticsearch
 
 import (
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/WiFeng/go-sky/config"
 	"github.com/WiFeng/go-sky/log"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 )
 
 var (
 	testService = "testService"
 )
 
+// newTestServer returns a fake elasticsearch, which replies the cluster info
+// and echoes the decompressed request body in the other responses.
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `{"cluster_name":"test","version":{"number":"7.12.0"}}`)
+			return
+		}
+
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		b, _ := ioutil.ReadAll(body)
+		if strings.HasSuffix(r.URL.Path, "/_bulk") {
+			fmt.Fprint(w, bulkResponse(b))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/docs/") || strings.HasPrefix(r.URL.Path, "/missing/") ||
+			r.URL.Path == "/_search/scroll" {
+			searchResponse(w, r, b)
+			return
+		}
+		fmt.Fprintf(w, `{"took":1,"echo":%q}`, b)
+	}))
+}
+
+// bulkResponse fails the documents containing "fail".
+func bulkResponse(body []byte) string {
+	var items []string
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		if strings.Contains(lines[i+1], "fail") {
+			items = append(items, `{"index":{"_index":"idx","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed"}}}`)
+			continue
+		}
+		items = append(items, `{"index":{"_index":"idx","status":201}}`)
+	}
+	return `{"took":1,"errors":true,"items":[` + strings.Join(items, ",") + `]}`
+}
+
 func TestMain(m *testing.M) {
+	srv := newTestServer()
 
 	esConf := []config.Elasticsearch{
 		{
-			Name: "es1",
+			Name:  "es1",
+			Addrs: []string{srv.URL},
+		},
+		{
+			Name:                "es2",
+			Addrs:               []string{srv.URL},
+			CompressRequestBody: true,
 		},
 	}
 
@@ -31,9 +94,186 @@ func TestMain(m *testing.M) {
 
 	Init(context.Background(), testService, esConf)
 
-	os.Exit(m.Run())
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
 }
 
 func TestPing(t *testing.T) {
+	cl, err := GetInstance(context.Background(), "es1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cl.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.IsError() {
+		t.Errorf("Ping status = %s", res.Status())
+	}
+}
+
+func TestCompressRequestBody(t *testing.T) {
+	cl, err := GetInstance(context.Background(), "es2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `{"query":{"match_all":{}}}`
+	res, err := cl.Search(cl.Search.WithIndex("idx"), cl.Search.WithBody(strings.NewReader(query)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, _ := ioutil.ReadAll(res.Body)
+	if !strings.Contains(string(b), `{\"query\":{\"match_all\":{}}}`) {
+		t.Errorf("Search response = %s", b)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		cf  config.Elasticsearch
+		err error
+	}{
+		{config.Elasticsearch{Addrs: []string{"http://localhost:9200"}}, nil},
+		{config.Elasticsearch{Addrs: []string{"http://localhost:9200"}, CloudID: "c"}, ErrAddrsWithCloudID},
+		{config.Elasticsearch{APIKey: "k", Username: "u"}, ErrAPIKeyWithPassword},
+		{config.Elasticsearch{MaxRetries: -1}, ErrInvalidMaxRetries},
+		{config.Elasticsearch{RetryOnStatus: []int{503, 5000}}, ErrInvalidRetryOnStatus},
+	}
+
+	for _, c := range cases {
+		if err := validate(c.cf); err != c.err {
+			t.Errorf("validate(%+v) = %v; want %v", c.cf, err, c.err)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	cases := []struct {
+		method    string
+		path      string
+		index     string
+		operation string
+	}{
+		{"GET", "/", "", "info"},
+		{"POST", "/idx/_search", "idx", "search"},
+		{"POST", "/_search/scroll", "", "scroll"},
+		{"POST", "/_bulk", "", "bulk"},
+		{"POST", "/idx/_bulk", "idx", "bulk"},
+		{"PUT", "/idx/_doc/1", "idx", "index"},
+		{"POST", "/idx/_doc", "idx", "index"},
+		{"PUT", "/idx/_create/1", "idx", "index"},
+		{"GET", "/idx/_doc/1", "idx", "get"},
+		{"DELETE", "/idx/_doc/1", "idx", "delete"},
+		{"POST", "/idx/_update/1", "idx", "update"},
+		{"GET", "/idx/type/1", "idx", "get"},
+		{"PUT", "/idx", "idx", "indices"},
+		{"GET", "/_cluster/health", "", "cluster"},
+	}
+
+	for _, c := range cases {
+		index, operation := parseRequest(c.method, c.path)
+		if index != c.index || operation != c.operation {
+			t.Errorf("parseRequest(%s, %s) = %s, %s; want %s, %s", c.method, c.path, index, operation, c.index, c.operation)
+		}
+	}
+}
 
+func TestParseTook(t *testing.T) {
+	for head, want := range map[string]int{
+		`{"took":12,"timed_out":false`: 12,
+		`{"took":`:                     -1,
+		`{"_index":"idx"`:              -1,
+	} {
+		if got := parseTook([]byte(head)); got != want {
+			t.Errorf("parseTook(%s) = %d; want %d", head, got, want)
+		}
+	}
+}
+
+func TestBulkIndexer(t *testing.T) {
+	var ctx = context.Background()
+	var failures int32
+
+	bi, err := NewBulkIndexer(ctx, "es1", BulkIndexerOptions{
+		Index:      "idx",
+		NumWorkers: 1,
+		OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			atomic.AddInt32(&failures, 1)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range []string{`{"a":1}`, `{"a":"fail"}`, `{"a":3}`} {
+		err := bi.Add(ctx, esutil.BulkIndexerItem{Action: "index", Body: strings.NewReader(doc)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = bi.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = bi.Close(ctx); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+
+	stats := bi.Stats()
+	if stats.NumAdded != 3 || stats.NumFlushed != 2 || stats.NumFailed != 1 {
+		t.Errorf("Stats = %+v", stats)
+	}
+	if n := atomic.LoadInt32(&failures); n != 1 {
+		t.Errorf("OnFailure is called %d times; want 1", n)
+	}
+}
+
+func TestBulkIndexerName(t *testing.T) {
+	var ctx = context.Background()
+
+	bi, err := NewBulkIndexer(ctx, "es1", BulkIndexerOptions{Name: "dup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewBulkIndexer(ctx, "es1", BulkIndexerOptions{Name: "dup"}); err != ErrBulkIndexerExists {
+		t.Errorf("NewBulkIndexer = %v; want %v", err, ErrBulkIndexerExists)
+	}
+
+	// The name is released after the indexer is closed.
+	if err = bi.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bi, err = NewBulkIndexer(ctx, "es1", BulkIndexerOptions{Name: "dup"}); err != nil {
+		t.Fatalf("NewBulkIndexer after Close = %v", err)
+	}
+	bi.Close(ctx)
+}
+
+func TestBulkIndexerFlushSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	b := &BulkIndexer{instance: "es1", name: "spans"}
+	for _, requested := range []bool{true, false} {
+		ctx := b.onFlushStart(context.Background())
+		if requested {
+			markBulkRequest(ctx)
+		}
+		b.onFlushEnd(ctx)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("finished spans = %d; want 2", len(spans))
+	}
+	if spans[0].Tag("bulk.requested") != nil || spans[1].Tag("bulk.requested") != false {
+		t.Errorf("span tags = %v, %v; want bulk.requested=false on the second", spans[0].Tags(), spans[1].Tags())
+	}
 }
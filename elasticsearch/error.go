@@ -0,0 +1,99 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+var (
+	// ErrNotFound is matched by errors.Is for the 404 responses.
+	ErrNotFound = errors.New("elasticsearch not found")
+	// ErrConflict is matched by errors.Is for the 409 responses, e.g. a version conflict.
+	ErrConflict = errors.New("elasticsearch conflict")
+	// ErrTooManyRequests is matched by errors.Is for the 429 responses, e.g. a rejected execution.
+	ErrTooManyRequests = errors.New("elasticsearch too many requests")
+)
+
+// Error is the error body of an elasticsearch response.
+type Error struct {
+	Status    int
+	Type      string
+	Reason    string
+	RootCause []ErrorCause
+}
+
+// ErrorCause ...
+type ErrorCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+	Index  string `json:"index,omitempty"`
+}
+
+// Error ...
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("elasticsearch: [%d] %s", e.Status, e.Reason)
+	}
+	return fmt.Sprintf("elasticsearch: [%d] %s: %s", e.Status, e.Type, e.Reason)
+}
+
+// Is maps the status to ErrNotFound, ErrConflict and ErrTooManyRequests.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrConflict:
+		return e.Status == http.StatusConflict
+	case ErrTooManyRequests:
+		return e.Status == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// ResponseError returns the *Error of the response, or nil if it's not an error.
+// The body is read, but not closed.
+func ResponseError(res *esapi.Response) error {
+	if !res.IsError() {
+		return nil
+	}
+
+	e := &Error{Status: res.StatusCode}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		e.Reason = err.Error()
+		return e
+	}
+
+	// The error is an object, or a string for some apis and proxies.
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err = json.Unmarshal(b, &body); err != nil || len(body.Error) == 0 {
+		e.Reason = string(b)
+		if e.Reason == "" {
+			e.Reason = http.StatusText(res.StatusCode)
+		}
+		return e
+	}
+
+	var detail struct {
+		Type      string       `json:"type"`
+		Reason    string       `json:"reason"`
+		RootCause []ErrorCause `json:"root_cause"`
+	}
+	if err = json.Unmarshal(body.Error, &detail); err != nil {
+		_ = json.Unmarshal(body.Error, &e.Reason)
+		return e
+	}
+
+	e.Type = detail.Type
+	e.Reason = detail.Reason
+	e.RootCause = detail.RootCause
+	return e
+}
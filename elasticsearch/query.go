@@ -0,0 +1,336 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+)
+
+// Query is a query of the query DSL.
+type Query interface {
+	Source() interface{}
+}
+
+// M is a raw json object of the query DSL.
+type M map[string]interface{}
+
+// Source ...
+func (m M) Source() interface{} {
+	return map[string]interface{}(m)
+}
+
+type leafQuery struct {
+	kind string
+	body interface{}
+}
+
+// Source ...
+func (q leafQuery) Source() interface{} {
+	return M{q.kind: q.body}
+}
+
+// MatchAll ...
+func MatchAll() Query {
+	return leafQuery{"match_all", M{}}
+}
+
+// Term matches the exact value of the field.
+func Term(field string, value interface{}) Query {
+	return leafQuery{"term", M{field: value}}
+}
+
+// Terms matches any of the exact values of the field.
+func Terms(field string, values ...interface{}) Query {
+	return leafQuery{"terms", M{field: values}}
+}
+
+// Match matches the analyzed text of the field.
+func Match(field string, text interface{}) Query {
+	return leafQuery{"match", M{field: text}}
+}
+
+// Exists matches the documents which have the field.
+func Exists(field string) Query {
+	return leafQuery{"exists", M{"field": field}}
+}
+
+// RangeQuery ...
+type RangeQuery struct {
+	field  string
+	params M
+}
+
+// Range matches the values of the field in the range, which is built by Gt, Gte, Lt and Lte.
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, params: M{}}
+}
+
+// Gt ...
+func (q *RangeQuery) Gt(v interface{}) *RangeQuery {
+	q.params["gt"] = v
+	return q
+}
+
+// Gte ...
+func (q *RangeQuery) Gte(v interface{}) *RangeQuery {
+	q.params["gte"] = v
+	return q
+}
+
+// Lt ...
+func (q *RangeQuery) Lt(v interface{}) *RangeQuery {
+	q.params["lt"] = v
+	return q
+}
+
+// Lte ...
+func (q *RangeQuery) Lte(v interface{}) *RangeQuery {
+	q.params["lte"] = v
+	return q
+}
+
+// Format sets the date format of the values.
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.params["format"] = format
+	return q
+}
+
+// Source ...
+func (q *RangeQuery) Source() interface{} {
+	return M{"range": M{q.field: q.params}}
+}
+
+// BoolQuery ...
+type BoolQuery struct {
+	must               []Query
+	filter             []Query
+	should             []Query
+	mustNot            []Query
+	minimumShouldMatch interface{}
+}
+
+// Bool combines the queries, which are added by Must, Filter, Should and MustNot.
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+// Must ...
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Filter is Must without scoring.
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// Should ...
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// MustNot ...
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch accepts a number or a percentage string, e.g. "50%".
+func (q *BoolQuery) MinimumShouldMatch(v interface{}) *BoolQuery {
+	q.minimumShouldMatch = v
+	return q
+}
+
+// Source ...
+func (q *BoolQuery) Source() interface{} {
+	body := M{}
+	for clause, queries := range map[string][]Query{
+		"must":     q.must,
+		"filter":   q.filter,
+		"should":   q.should,
+		"must_not": q.mustNot,
+	} {
+		if len(queries) > 0 {
+			body[clause] = sources(queries)
+		}
+	}
+	if q.minimumShouldMatch != nil {
+		body["minimum_should_match"] = q.minimumShouldMatch
+	}
+	return M{"bool": body}
+}
+
+func sources(queries []Query) []interface{} {
+	s := make([]interface{}, 0, len(queries))
+	for _, q := range queries {
+		s = append(s, q.Source())
+	}
+	return s
+}
+
+// Aggregation is an aggregation of the query DSL.
+type Aggregation interface {
+	Source() interface{}
+}
+
+// BucketAggregation is an aggregation which may have sub aggregations.
+type BucketAggregation struct {
+	kind string
+	body interface{}
+	aggs map[string]Aggregation
+}
+
+// TermsAgg buckets the documents by the values of the field, the size
+// most frequent ones are returned, or 10 if size is 0.
+func TermsAgg(field string, size int) *BucketAggregation {
+	params := M{"field": field}
+	if size > 0 {
+		params["size"] = size
+	}
+	return &BucketAggregation{kind: "terms", body: params}
+}
+
+// DateHistogramAgg buckets the documents by the calendar interval of the date field, e.g. "1d".
+func DateHistogramAgg(field string, calendarInterval string) *BucketAggregation {
+	return &BucketAggregation{kind: "date_histogram", body: M{"field": field, "calendar_interval": calendarInterval}}
+}
+
+// FilterAgg buckets the documents matching the query.
+func FilterAgg(q Query) *BucketAggregation {
+	return &BucketAggregation{kind: "filter", body: q.Source()}
+}
+
+// SubAgg adds a sub aggregation computed in every bucket.
+func (a *BucketAggregation) SubAgg(name string, agg Aggregation) *BucketAggregation {
+	if a.aggs == nil {
+		a.aggs = map[string]Aggregation{}
+	}
+	a.aggs[name] = agg
+	return a
+}
+
+// Source ...
+func (a *BucketAggregation) Source() interface{} {
+	source := M{a.kind: a.body}
+	if len(a.aggs) > 0 {
+		source["aggs"] = aggSources(a.aggs)
+	}
+	return source
+}
+
+// MetricAgg computes a metric of the field, kind is avg, sum, min, max, cardinality or value_count.
+func MetricAgg(kind string, field string) Aggregation {
+	return leafQuery{kind, M{"field": field}}
+}
+
+func aggSources(aggs map[string]Aggregation) M {
+	s := make(M, len(aggs))
+	for name, agg := range aggs {
+		s[name] = agg.Source()
+	}
+	return s
+}
+
+// SearchBody is the body of a search request.
+type SearchBody struct {
+	query       Query
+	size        int
+	from        int
+	sort        []interface{}
+	source      []string
+	searchAfter []interface{}
+	aggs        map[string]Aggregation
+	trackTotal  bool
+}
+
+// NewSearchBody returns the body searching the query, which is match_all if it's nil.
+func NewSearchBody(q Query) *SearchBody {
+	return &SearchBody{query: q, size: -1}
+}
+
+// Size sets how many hits are returned, 10 by default.
+func (b *SearchBody) Size(n int) *SearchBody {
+	b.size = n
+	return b
+}
+
+// From sets the offset of the hits, use SearchAfter for the deep pages instead.
+func (b *SearchBody) From(n int) *SearchBody {
+	b.from = n
+	return b
+}
+
+// SortAsc ...
+func (b *SearchBody) SortAsc(field string) *SearchBody {
+	b.sort = append(b.sort, M{field: M{"order": "asc"}})
+	return b
+}
+
+// SortDesc ...
+func (b *SearchBody) SortDesc(field string) *SearchBody {
+	b.sort = append(b.sort, M{field: M{"order": "desc"}})
+	return b
+}
+
+// Includes sets the fields of _source to return.
+func (b *SearchBody) Includes(fields ...string) *SearchBody {
+	b.source = fields
+	return b
+}
+
+// SearchAfter sets the sort values of the last hit of the previous page.
+func (b *SearchBody) SearchAfter(values ...interface{}) *SearchBody {
+	b.searchAfter = values
+	return b
+}
+
+// Agg adds an aggregation, whose result is in SearchResult.Aggregations by name.
+func (b *SearchBody) Agg(name string, agg Aggregation) *SearchBody {
+	if b.aggs == nil {
+		b.aggs = map[string]Aggregation{}
+	}
+	b.aggs[name] = agg
+	return b
+}
+
+// TrackTotalHits counts all of the hits, rather than up to 10000.
+func (b *SearchBody) TrackTotalHits() *SearchBody {
+	b.trackTotal = true
+	return b
+}
+
+// Source ...
+func (b *SearchBody) Source() interface{} {
+	source := M{}
+	if b.query != nil {
+		source["query"] = b.query.Source()
+	}
+	if b.size >= 0 {
+		source["size"] = b.size
+	}
+	if b.from > 0 {
+		source["from"] = b.from
+	}
+	if len(b.sort) > 0 {
+		source["sort"] = b.sort
+	}
+	if b.source != nil {
+		source["_source"] = b.source
+	}
+	if len(b.searchAfter) > 0 {
+		source["search_after"] = b.searchAfter
+	}
+	if len(b.aggs) > 0 {
+		source["aggs"] = aggSources(b.aggs)
+	}
+	if b.trackTotal {
+		source["track_total_hits"] = true
+	}
+	return source
+}
+
+// MarshalJSON ...
+func (b *SearchBody) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Source())
+}
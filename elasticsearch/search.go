@@ -0,0 +1,283 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+var (
+	// ErrStopIteration is returned by the function of SearchAfter and Scroll to stop
+	// the iteration, which is not returned as an error then.
+	ErrStopIteration = errors.New("elasticsearch stop iteration")
+	// ErrNoSort ...
+	ErrNoSort = errors.New("elasticsearch search after needs the sort of the body")
+	// ErrNoAggregation ...
+	ErrNoAggregation = errors.New("elasticsearch aggregation is not in the result")
+)
+
+// defaultScrollKeepAlive is the keep alive of Scroll if it's not set.
+const defaultScrollKeepAlive = time.Minute
+
+// SearchResult is the response of a search request.
+type SearchResult struct {
+	Took     int  `json:"took"`
+	TimedOut bool `json:"timed_out"`
+	Hits     struct {
+		Total    TotalHits `json:"total"`
+		MaxScore *float64  `json:"max_score"`
+		Hits     []Hit     `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+	ScrollID     string                     `json:"_scroll_id"`
+}
+
+// TotalHits is the number of the hits, Relation is `gte` if it's a lower bound.
+type TotalHits struct {
+	Value    int64  `json:"value"`
+	Relation string `json:"relation"`
+}
+
+// UnmarshalJSON accepts the number as well, which is returned for rest_total_hits_as_int.
+func (t *TotalHits) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] != '{' {
+		t.Relation = "eq"
+		return json.Unmarshal(b, &t.Value)
+	}
+
+	type totalHits TotalHits
+	return json.Unmarshal(b, (*totalHits)(t))
+}
+
+// Hit ...
+type Hit struct {
+	Index  string            `json:"_index"`
+	ID     string            `json:"_id"`
+	Score  *float64          `json:"_score"`
+	Source json.RawMessage   `json:"_source"`
+	Sort   []json.RawMessage `json:"sort"`
+}
+
+// SortValues returns the sort values of the hit for SearchBody.SearchAfter. They
+// are kept as they are in the response, e.g. the long values above 2^53 are exact.
+func (h Hit) SortValues() []interface{} {
+	values := make([]interface{}, len(h.Sort))
+	for i, v := range h.Sort {
+		values[i] = v
+	}
+	return values
+}
+
+// Decode decodes the _source of the hits into dest, which is a pointer to []T or []*T.
+func (r *SearchResult) Decode(dest interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, hit := range r.Hits.Hits {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if len(hit.Source) == 0 {
+			buf.WriteString("null")
+			continue
+		}
+		buf.Write(hit.Source)
+	}
+	buf.WriteByte(']')
+	return json.Unmarshal(buf.Bytes(), dest)
+}
+
+// DecodeAggregation decodes the result of the aggregation into dest, e.g. a struct
+// with the Buckets field for TermsAgg, or the Value field for MetricAgg.
+func (r *SearchResult) DecodeAggregation(name string, dest interface{}) error {
+	raw, ok := r.Aggregations[name]
+	if !ok {
+		return ErrNoAggregation
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// Search searches the index of the elasticsearch instance `name`, the hits are decoded
+// into dest if it's not nil, see SearchResult.Decode. The index may be a comma-separated
+// list or a pattern, and the error response is returned as *Error.
+func Search(ctx context.Context, name string, index string, body *SearchBody, dest interface{}) (*SearchResult, error) {
+	r, err := search(ctx, name, index, body, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if dest != nil {
+		if err = r.Decode(dest); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// SearchAfter calls fn with the pages of the hits until there is no more, or fn returns an error.
+// The body must be sorted by a unique field, as the tiebreaker, the search_after of
+// the body is updated to the sort values of the last hit on every page.
+func SearchAfter(ctx context.Context, name string, index string, body *SearchBody, fn func(*SearchResult) error) error {
+	if len(body.sort) == 0 {
+		return ErrNoSort
+	}
+
+	for {
+		r, err := search(ctx, name, index, body, 0)
+		if err != nil {
+			return err
+		}
+
+		hits := r.Hits.Hits
+		if len(hits) == 0 {
+			return nil
+		}
+
+		if err = fn(r); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+
+		body.SearchAfter(hits[len(hits)-1].SortValues()...)
+	}
+}
+
+// Scroll calls fn with the batches of the hits until there is no more, or fn returns an error.
+// The search context is kept alive for keepAlive between the batches, and cleared at the end.
+// SearchAfter is preferred except for the snapshot of all of the hits, e.g. a reindex.
+func Scroll(ctx context.Context, name string, index string, body *SearchBody, keepAlive time.Duration, fn func(*SearchResult) error) error {
+	if keepAlive < time.Millisecond {
+		keepAlive = defaultScrollKeepAlive
+	}
+
+	r, err := search(ctx, name, index, body, keepAlive)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r.ScrollID != "" {
+			clearScroll(ctx, name, r.ScrollID)
+		}
+	}()
+
+	for len(r.Hits.Hits) > 0 {
+		if err = fn(r); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+
+		next, err := scroll(ctx, name, r.ScrollID, keepAlive)
+		if err != nil {
+			return err
+		}
+		if next.ScrollID == "" {
+			next.ScrollID = r.ScrollID
+		}
+		r = next
+	}
+	return nil
+}
+
+func search(ctx context.Context, name string, index string, body *SearchBody, keepAlive time.Duration) (*SearchResult, error) {
+	cl, err := GetInstance(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		body = NewSearchBody(nil)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []func(*esapi.SearchRequest){
+		cl.Search.WithContext(ctx),
+		cl.Search.WithBody(bytes.NewReader(b)),
+	}
+	if index != "" {
+		opts = append(opts, cl.Search.WithIndex(strings.Split(index, ",")...))
+	}
+	if keepAlive > 0 {
+		opts = append(opts, cl.Search.WithScroll(keepAlive))
+	}
+
+	res, err := cl.Search(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSearchResult(res)
+}
+
+func scroll(ctx context.Context, name string, scrollID string, keepAlive time.Duration) (*SearchResult, error) {
+	cl, err := GetInstance(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The scroll id is sent in the body, since it may be too long for the url.
+	b, err := json.Marshal(map[string]string{"scroll": formatKeepAlive(keepAlive), "scroll_id": scrollID})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := cl.Scroll(cl.Scroll.WithContext(ctx), cl.Scroll.WithBody(bytes.NewReader(b)))
+	if err != nil {
+		return nil, err
+	}
+	return decodeSearchResult(res)
+}
+
+// clearScroll frees the search context, the error is logged only, since the context
+// expires after the keep alive anyway.
+func clearScroll(ctx context.Context, name string, scrollID string) {
+	cl, err := GetInstance(ctx, name)
+	if err != nil {
+		return
+	}
+
+	b, err := json.Marshal(map[string][]string{"scroll_id": {scrollID}})
+	if err != nil {
+		return
+	}
+
+	res, err := cl.ClearScroll(cl.ClearScroll.WithBody(bytes.NewReader(b)))
+	if err == nil {
+		defer res.Body.Close()
+		err = ResponseError(res)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Errorw(ctx, "elasticsearch clear scroll error", "instance", name, "err", err)
+	}
+}
+
+func decodeSearchResult(res *esapi.Response) (*SearchResult, error) {
+	defer res.Body.Close()
+
+	if err := ResponseError(res); err != nil {
+		return nil, err
+	}
+
+	var r SearchResult
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// formatKeepAlive formats the duration in the time units of elasticsearch.
+func formatKeepAlive(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms"
+}
@@ -0,0 +1,218 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testDocs is the number of the documents in the index `docs` of the test server.
+const testDocs = 5
+
+var testClearedScrolls int32
+
+type testDoc struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// searchResponse replies the search requests of the index `docs`, whose documents are
+// sorted by id, as well as the scroll requests, whose scroll id is `offset,size`.
+func searchResponse(w http.ResponseWriter, r *http.Request, body []byte) {
+	if strings.HasPrefix(r.URL.Path, "/missing/") {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [missing]","index":"missing"}],`+
+			`"type":"index_not_found_exception","reason":"no such index [missing]","index":"missing"},"status":404}`)
+		return
+	}
+
+	if r.URL.Path == "/_search/scroll" && r.Method == http.MethodDelete {
+		atomic.AddInt32(&testClearedScrolls, 1)
+		fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+		return
+	}
+
+	var req struct {
+		Size        *int          `json:"size"`
+		SearchAfter []int         `json:"search_after"`
+		Aggs        interface{}   `json:"aggs"`
+		ScrollID    string        `json:"scroll_id"`
+		Sort        []interface{} `json:"sort"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":{"type":"parse_exception","reason":%q},"status":400}`, err.Error())
+		return
+	}
+
+	offset, size := 0, 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+	if len(req.SearchAfter) > 0 {
+		offset = req.SearchAfter[0]
+	}
+	if req.ScrollID != "" {
+		fmt.Sscanf(req.ScrollID, "%d,%d", &offset, &size)
+	}
+
+	var hits []string
+	for id := offset + 1; id <= testDocs && len(hits) < size; id++ {
+		hits = append(hits, fmt.Sprintf(`{"_index":"docs","_id":"%d","_score":null,"_source":{"id":%d,"name":"doc%d"},"sort":[%d]}`, id, id, id, id))
+	}
+
+	resp := fmt.Sprintf(`{"took":1,"timed_out":false,"hits":{"total":{"value":%d,"relation":"eq"},"max_score":null,"hits":[%s]}`,
+		testDocs, strings.Join(hits, ","))
+	if req.Aggs != nil {
+		resp += `,"aggregations":{"by_name":{"buckets":[{"key":"doc","doc_count":5}]}}`
+	}
+	if r.URL.Query().Get("scroll") != "" || req.ScrollID != "" {
+		resp += fmt.Sprintf(`,"_scroll_id":"%d,%d"`, offset+len(hits), size)
+	}
+	fmt.Fprint(w, resp+"}")
+}
+
+func TestQuerySource(t *testing.T) {
+	body := NewSearchBody(
+		Bool().
+			Must(Match("title", "go sky")).
+			Filter(Term("status", 1), Range("created").Gte("2021-01-01").Lt("now")).
+			MustNot(Exists("deleted")),
+	).Size(20).SortDesc("created").Agg("by_status", TermsAgg("status", 5).SubAgg("avg_score", MetricAgg("avg", "score")))
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"aggs":{"by_status":{"aggs":{"avg_score":{"avg":{"field":"score"}}},"terms":{"field":"status","size":5}}},` +
+		`"query":{"bool":{"filter":[{"term":{"status":1}},{"range":{"created":{"gte":"2021-01-01","lt":"now"}}}],` +
+		`"must":[{"match":{"title":"go sky"}}],"must_not":[{"exists":{"field":"deleted"}}]}},` +
+		`"size":20,"sort":[{"created":{"order":"desc"}}]}`
+	if string(b) != want {
+		t.Errorf("Marshal = %s; want %s", b, want)
+	}
+
+	b, _ = json.Marshal(NewSearchBody(nil))
+	if string(b) != `{}` {
+		t.Errorf("Marshal empty body = %s", b)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	var docs []testDoc
+	r, err := Search(context.Background(), "es1", "docs", NewSearchBody(MatchAll()).Size(2).Agg("by_name", TermsAgg("name", 0)), &docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Hits.Total.Value != testDocs || len(docs) != 2 || docs[1] != (testDoc{2, "doc2"}) {
+		t.Errorf("Search = %+v, %+v", r.Hits.Total, docs)
+	}
+
+	var byName struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int64  `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	if err = r.DecodeAggregation("by_name", &byName); err != nil || len(byName.Buckets) != 1 || byName.Buckets[0].DocCount != 5 {
+		t.Errorf("DecodeAggregation = %+v, %v", byName, err)
+	}
+	if err = r.DecodeAggregation("by_id", &byName); err != ErrNoAggregation {
+		t.Errorf("DecodeAggregation = %v; want %v", err, ErrNoAggregation)
+	}
+}
+
+func TestSearchError(t *testing.T) {
+	_, err := Search(context.Background(), "es1", "missing", nil, nil)
+
+	var esErr *Error
+	if !errors.As(err, &esErr) {
+		t.Fatalf("Search error = %v", err)
+	}
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = false", err)
+	}
+	if esErr.Type != "index_not_found_exception" || len(esErr.RootCause) != 1 || esErr.RootCause[0].Index != "missing" {
+		t.Errorf("Search error = %+v", esErr)
+	}
+}
+
+func TestSearchAfter(t *testing.T) {
+	var ids []int
+	err := SearchAfter(context.Background(), "es1", "docs", NewSearchBody(nil).Size(2).SortAsc("id"), func(r *SearchResult) error {
+		var docs []*testDoc
+		if err := r.Decode(&docs); err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+		t.Errorf("SearchAfter ids = %v", ids)
+	}
+
+	if err = SearchAfter(context.Background(), "es1", "docs", NewSearchBody(nil), nil); err != ErrNoSort {
+		t.Errorf("SearchAfter without sort = %v; want %v", err, ErrNoSort)
+	}
+}
+
+func TestHitSortValues(t *testing.T) {
+	var hit Hit
+	if err := json.Unmarshal([]byte(`{"_id":"1","sort":[9007199254740993,"a",1.5]}`), &hit); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(NewSearchBody(nil).SearchAfter(hit.SortValues()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"search_after":[9007199254740993,"a",1.5]}`; string(b) != want {
+		t.Errorf("Marshal = %s; want %s", b, want)
+	}
+}
+
+func TestScroll(t *testing.T) {
+	cleared := atomic.LoadInt32(&testClearedScrolls)
+
+	var pages int
+	err := Scroll(context.Background(), "es1", "docs", NewSearchBody(nil).Size(2), 0, func(r *SearchResult) error {
+		pages++
+		if pages == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 {
+		t.Errorf("Scroll pages = %d; want 2", pages)
+	}
+
+	pages = 0
+	if err = Scroll(context.Background(), "es1", "docs", NewSearchBody(nil).Size(2), 0, func(r *SearchResult) error {
+		pages++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if pages != 3 {
+		t.Errorf("Scroll pages = %d; want 3", pages)
+	}
+
+	if n := atomic.LoadInt32(&testClearedScrolls) - cleared; n != 2 {
+		t.Errorf("Scroll cleared %d times; want 2", n)
+	}
+}
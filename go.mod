@@ -1,20 +1,24 @@
 module github.com/WiFeng/go-sky
 
-go 1.13
+go 1.16
 
 require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/Shopify/sarama v1.19.0
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/elastic/go-elasticsearch/v7 v7.12.0
 	github.com/go-kit/kit v0.10.0
 	github.com/go-redis/redis/v8 v8.6.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/gorilla/mux v1.7.3
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/oklog/oklog v0.3.2
 	github.com/opentracing/opentracing-go v1.2.0
 	github.com/prometheus/client_golang v1.9.0
 	github.com/uber/jaeger-client-go v2.25.0+incompatible
 	github.com/uber/jaeger-lib v2.4.0+incompatible
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	go.uber.org/zap v1.16.0
+	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
@@ -1,22 +1,61 @@
 package helper
 
+import (
+	"sync"
+)
+
 var (
-	deferFunc []func()
+	deferMu    sync.Mutex
+	deferFunc  []deferEntry
+	deferIndex uint64
 )
 
+type deferEntry struct {
+	id uint64
+	f  func()
+}
+
 // AddDeferFunc ...
 func AddDeferFunc(f func()) {
+	addDeferFunc(f)
+}
+
+// RunDeferFunc ...
+func RunDeferFunc() {
+	deferMu.Lock()
+	funcs := make([]deferEntry, len(deferFunc))
+	copy(funcs, deferFunc)
+	deferMu.Unlock()
+
+	for _, e := range funcs {
+		e.f()
+	}
+}
+
+// addDeferFunc adds f and returns its id for removeDeferFunc, or 0 if f is nil.
+func addDeferFunc(f func()) uint64 {
 	// no op
 	if f == nil {
-		return
+		return 0
 	}
 
-	deferFunc = append(deferFunc, f)
+	deferMu.Lock()
+	defer deferMu.Unlock()
+
+	deferIndex++
+	deferFunc = append(deferFunc, deferEntry{id: deferIndex, f: f})
+	return deferIndex
 }
 
-// RunDeferFunc ...
-func RunDeferFunc() {
-	for _, f := range deferFunc {
-		f()
+// removeDeferFunc removes the func added with the id.
+func removeDeferFunc(id uint64) {
+	deferMu.Lock()
+	defer deferMu.Unlock()
+
+	for i, e := range deferFunc {
+		if e.id == id {
+			deferFunc = append(deferFunc[:i:i], deferFunc[i+1:]...)
+			return
+		}
 	}
 }
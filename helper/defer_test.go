@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"sync"
+	"testing"
+)
+
+func resetDeferFunc(t *testing.T) {
+	deferMu.Lock()
+	deferFunc = nil
+	deferMu.Unlock()
+	t.Cleanup(func() {
+		deferMu.Lock()
+		deferFunc = nil
+		deferMu.Unlock()
+	})
+}
+
+func TestDeferFuncConcurrent(t *testing.T) {
+	resetDeferFunc(t)
+
+	var mu sync.Mutex
+	var n int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			AddDeferFunc(func() {
+				mu.Lock()
+				n++
+				mu.Unlock()
+			})
+		}()
+	}
+	wg.Wait()
+
+	RunDeferFunc()
+	if n != 10 {
+		t.Errorf("defer funcs run = %d; want 10", n)
+	}
+}
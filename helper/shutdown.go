@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	shutdownMu      sync.Mutex
+	shutdownRunners = map[uint64]func(os.Signal){}
+	shutdownIndex   uint64
+	shutdownSignal  chan os.Signal
+)
+
+// RunUntilShutdown returns a context of a long running runner, e.g. a consumer,
+// which is canceled when ctx is done, SIGINT/SIGTERM is received or RunDeferFunc
+// is called. onSignal is called with the signal received, if it's not nil.
+//
+// The runner must call the returned stop function when it exits, which cancels
+// the context, and which RunDeferFunc waits for.
+func RunUntilShutdown(ctx context.Context, onSignal func(os.Signal)) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	deferID := addDeferFunc(func() {
+		cancel()
+		<-done
+	})
+
+	watchID := watchSignal(func(sig os.Signal) {
+		if onSignal != nil {
+			onSignal(sig)
+		}
+		cancel()
+	})
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			unwatchSignal(watchID)
+			removeDeferFunc(deferID)
+			cancel()
+			close(done)
+		})
+	}
+	return ctx, stop
+}
+
+// watchSignal calls f when SIGINT/SIGTERM is received. The signals are watched
+// by a single goroutine of the process, and only while there are runners.
+func watchSignal(f func(os.Signal)) uint64 {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+
+	if shutdownSignal == nil {
+		shutdownSignal = make(chan os.Signal, 1)
+		go func() {
+			for sig := range shutdownSignal {
+				shutdownMu.Lock()
+				runners := make([]func(os.Signal), 0, len(shutdownRunners))
+				for _, r := range shutdownRunners {
+					runners = append(runners, r)
+				}
+				shutdownMu.Unlock()
+
+				for _, r := range runners {
+					r(sig)
+				}
+			}
+		}()
+	}
+	if len(shutdownRunners) == 0 {
+		signal.Notify(shutdownSignal, syscall.SIGINT, syscall.SIGTERM)
+	}
+
+	shutdownIndex++
+	shutdownRunners[shutdownIndex] = f
+	return shutdownIndex
+}
+
+// unwatchSignal removes the runner, and restores the default behavior of the
+// signals after the last one.
+func unwatchSignal(id uint64) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+
+	delete(shutdownRunners, id)
+	if len(shutdownRunners) == 0 {
+		signal.Stop(shutdownSignal)
+	}
+}
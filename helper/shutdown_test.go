@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunUntilShutdownStop(t *testing.T) {
+	resetDeferFunc(t)
+
+	ctx, stop := RunUntilShutdown(context.Background(), nil)
+	stop()
+	stop()
+
+	if ctx.Err() == nil {
+		t.Error("ctx is not canceled after stop")
+	}
+	if len(deferFunc) != 0 || len(shutdownRunners) != 0 {
+		t.Errorf("defer funcs = %d, runners = %d after stop; want 0", len(deferFunc), len(shutdownRunners))
+	}
+}
+
+func TestRunUntilShutdownDefer(t *testing.T) {
+	resetDeferFunc(t)
+
+	ctx, stop := RunUntilShutdown(context.Background(), nil)
+	exited := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(exited)
+		stop()
+	}()
+
+	// RunDeferFunc cancels the runner, and waits for it to stop.
+	RunDeferFunc()
+	select {
+	case <-exited:
+	default:
+		t.Error("RunDeferFunc returns before the runner stops")
+	}
+}
+
+func TestRunUntilShutdownSignal(t *testing.T) {
+	resetDeferFunc(t)
+
+	signals := make(chan os.Signal, 2)
+	ctx1, stop1 := RunUntilShutdown(context.Background(), func(sig os.Signal) { signals <- sig })
+	defer stop1()
+	ctx2, stop2 := RunUntilShutdown(context.Background(), func(sig os.Signal) { signals <- sig })
+	defer stop2()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("ctx is not canceled by the signal")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if sig := <-signals; sig != syscall.SIGTERM {
+			t.Errorf("signal = %v; want %v", sig, syscall.SIGTERM)
+		}
+	}
+}
@@ -124,7 +124,20 @@ func ListenAndServe(ctx context.Context, conf config.HTTP, httpHandler http.Hand
 
 func errorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
 	log.Error(ctx, err)
-	w.WriteHeader(http.StatusInternalServerError)
+
+	// Honour the status code and the headers of the errors, e.g. 429 of the rate limiter.
+	if headerer, ok := err.(kithttp.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	code := http.StatusInternalServerError
+	if sc, ok := err.(kithttp.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
 }
 
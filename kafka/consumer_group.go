@@ -0,0 +1,273 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/WiFeng/go-sky/helper"
+	"github.com/WiFeng/go-sky/log"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+var (
+	// ErrGroupIDNotFound ...
+	ErrGroupIDNotFound = errors.New("kafka consumer group id is not found")
+	// ErrHandlerPanic ...
+	ErrHandlerPanic = errors.New("kafka handler panic error")
+)
+
+// ConsumerGroupHandler handles the messages claimed by RunConsumerGroup.
+// The offset of a message is marked only when Handle returns nil.
+type ConsumerGroupHandler interface {
+	Handle(ctx context.Context, msg *kafka.ConsumerMessage) error
+}
+
+// ConsumerGroupHandlerFunc ...
+type ConsumerGroupHandlerFunc func(ctx context.Context, msg *kafka.ConsumerMessage) error
+
+// Handle ...
+func (f ConsumerGroupHandlerFunc) Handle(ctx context.Context, msg *kafka.ConsumerMessage) error {
+	return f(ctx, msg)
+}
+
+// ConsumerGroupOption ...
+type ConsumerGroupOption func(*consumerGroupOptions)
+
+type consumerGroupOptions struct {
+	retryBackoff   time.Duration
+	maxAttempts    int
+	maxConcurrency int
+}
+
+// ConsumerGroupRetryBackoff sets the wait time before a failed message is handled again.
+func ConsumerGroupRetryBackoff(d time.Duration) ConsumerGroupOption {
+	return func(o *consumerGroupOptions) {
+		o.retryBackoff = d
+	}
+}
+
+// ConsumerGroupMaxAttempts limits how many times a message is handled. The message
+// failed n times is logged and skipped, so that it doesn't block its partition.
+// It's 0 by default, the failed message is handled again until it succeeds.
+// Use NewRetryHandler to keep the failed messages in the retry and dead letter topics.
+func ConsumerGroupMaxAttempts(n int) ConsumerGroupOption {
+	return func(o *consumerGroupOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// ConsumerGroupMaxConcurrency limits how many partitions are handled at the same time.
+// Messages of the same partition are always handled one by one, in order.
+func ConsumerGroupMaxConcurrency(n int) ConsumerGroupOption {
+	return func(o *consumerGroupOptions) {
+		o.maxConcurrency = n
+	}
+}
+
+// RunConsumerGroup joins the consumer group configured for the kafka instance `name`
+// and handles the messages of topics until ctx is done, SIGINT/SIGTERM is received
+// or the process runs its defer functions. It rejoins the group after every rebalance,
+// and blocks until the group is closed.
+func RunConsumerGroup(ctx context.Context, name string, topics []string, handler ConsumerGroupHandler, opt ...ConsumerGroupOption) error {
+	kcf, ok := kafkaConfig[name]
+	if !ok {
+		return ErrConfigNotFound
+	}
+
+	groupID := kcf.Consumer.GroupID
+	if groupID == "" {
+		return ErrGroupIDNotFound
+	}
+
+	options := consumerGroupOptions{
+		retryBackoff: time.Second,
+	}
+	for _, o := range opt {
+		o(&options)
+	}
+
+	// The group owns its client, so that the errors channel
+	// does not affect consumers built from the shared one.
+	kConfig := newConfig(kcf)
+	kConfig.Consumer.Return.Errors = true
+	cg, err := kafka.NewConsumerGroup(kcf.Addrs, groupID, kConfig)
+	if err != nil {
+		log.Errorw(ctx, "kafka.NewConsumerGroup error", "name", name, "group_id", groupID, "err", err)
+		return err
+	}
+
+	ctx, stop := helper.RunUntilShutdown(ctx, func(sig os.Signal) {
+		log.Infow(ctx, "kafka consumer group prepare shutdown", "name", name, "group_id", groupID, "signal", sig.String())
+	})
+	defer stop()
+
+	go func() {
+		for err := range cg.Errors() {
+			log.Errorw(ctx, "kafka consumer group error", "name", name, "group_id", groupID, "err", err)
+		}
+	}()
+
+	h := &consumerGroupHandler{
+		name:         name,
+		groupID:      groupID,
+		handler:      handler,
+		retryBackoff: options.retryBackoff,
+		maxAttempts:  options.maxAttempts,
+	}
+	if options.maxConcurrency > 0 {
+		h.sem = make(chan struct{}, options.maxConcurrency)
+	}
+
+	log.Infow(ctx, "kafka consumer group start", "name", name, "group_id", groupID, "topics", topics)
+	for {
+		if err := cg.Consume(ctx, topics, h); err != nil {
+			if err == kafka.ErrClosedConsumerGroup {
+				break
+			}
+			log.Errorw(ctx, "kafka consumer group consume error", "name", name, "group_id", groupID, "err", err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(options.retryBackoff):
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err = cg.Close(); err != nil {
+		log.Warnw(context.Background(), "kafka consumer group close error", "name", name, "group_id", groupID, "err", err)
+	}
+
+	log.Infow(context.Background(), "kafka consumer group exit", "name", name, "group_id", groupID)
+	return nil
+}
+
+type sessionContextKey int
+
+const (
+	sessionContext sessionContextKey = 0
+)
+
+// sessionDone returns the done channel of the session that claimed the message
+// handled with ctx, or nil if ctx is not created by RunConsumerGroup.
+func sessionDone(ctx context.Context) <-chan struct{} {
+	if sessCtx, ok := ctx.Value(sessionContext).(context.Context); ok {
+		return sessCtx.Done()
+	}
+	return nil
+}
+
+type consumerGroupHandler struct {
+	name         string
+	groupID      string
+	handler      ConsumerGroupHandler
+	retryBackoff time.Duration
+	maxAttempts  int
+	sem          chan struct{}
+}
+
+// Setup ...
+func (h *consumerGroupHandler) Setup(sess kafka.ConsumerGroupSession) error {
+	log.Infow(sess.Context(), "kafka consumer group session setup", "name", h.name, "group_id", h.groupID,
+		"member_id", sess.MemberID(), "generation_id", sess.GenerationID(), "claims", sess.Claims())
+	return nil
+}
+
+// Cleanup ...
+func (h *consumerGroupHandler) Cleanup(sess kafka.ConsumerGroupSession) error {
+	log.Infow(context.Background(), "kafka consumer group session cleanup", "name", h.name, "group_id", h.groupID,
+		"member_id", sess.MemberID(), "generation_id", sess.GenerationID())
+	return nil
+}
+
+// ConsumeClaim ...
+func (h *consumerGroupHandler) ConsumeClaim(sess kafka.ConsumerGroupSession, claim kafka.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if err := h.handle(sess.Context(), msg); err != nil {
+			// The session is done, the message will be
+			// handled again by the next owner of the partition.
+			return nil
+		}
+		sess.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// handle retries msg until it is handled successfully, the max attempts are
+// reached or the session is done.
+func (h *consumerGroupHandler) handle(sessCtx context.Context, msg *kafka.ConsumerMessage) error {
+	for attempt := 1; ; attempt++ {
+		err := h.handleOnce(sessCtx, msg)
+		if err == nil {
+			return nil
+		}
+
+		if h.maxAttempts > 0 && attempt >= h.maxAttempts {
+			log.Errorw(sessCtx, "kafka handler give up", "name", h.name, "group_id", h.groupID, "topic", msg.Topic,
+				"partition", msg.Partition, "offset", msg.Offset, "attempts", attempt, "err", err)
+			return nil
+		}
+
+		select {
+		case <-sessCtx.Done():
+			return sessCtx.Err()
+		case <-time.After(h.retryBackoff):
+		}
+	}
+}
+
+func (h *consumerGroupHandler) handleOnce(sessCtx context.Context, msg *kafka.ConsumerMessage) (err error) {
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+		case <-sessCtx.Done():
+			return sessCtx.Err()
+		}
+		defer func() { <-h.sem }()
+	}
+
+	// The message in flight is not interrupted by a rebalance or shutdown,
+	// so the handler gets a context that is independent of the session.
+	var ctx = context.Background()
+	var span = opentracing.GlobalTracer().StartSpan(
+		"kafka.ConsumerGroup.Handle",
+		opentracing.Tag{Key: "message.topic", Value: msg.Topic},
+		opentracing.Tag{Key: "message.partition", Value: msg.Partition},
+		opentracing.Tag{Key: "message.offset", Value: msg.Offset},
+		opentracing.Tag{Key: "consumer.group", Value: h.groupID},
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "kafka"},
+		opentracingext.SpanKindConsumer,
+	)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = log.BuildLogger(ctx)
+	ctx = context.WithValue(ctx, sessionContext, sessCtx)
+
+	defer func(begin time.Time) {
+		if panicErr := recover(); panicErr != nil {
+			log.Errorw(ctx, "kafka handler panic error", "err", panicErr)
+			err = ErrHandlerPanic
+		}
+
+		if err != nil {
+			opentracingext.Error.Set(span, true)
+			span.SetTag("message.error", err.Error())
+			log.Errorw(ctx, "kafka handler error", "name", h.name, "group_id", h.groupID, "topic", msg.Topic,
+				"partition", msg.Partition, "offset", msg.Offset, "err", err)
+		}
+
+		log.Debugw(ctx, fmt.Sprintf("consume %s/%d/%d", msg.Topic, msg.Partition, msg.Offset), "name", h.name,
+			"group_id", h.groupID, "request_time", fmt.Sprintf("%.3f", float32(time.Since(begin).Microseconds())/1000))
+		span.Finish()
+	}(time.Now())
+
+	err = h.handler.Handle(ctx, msg)
+	return
+}
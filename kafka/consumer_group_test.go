@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/WiFeng/go-sky/config"
+)
+
+// newMockConsumerGroupBroker returns a broker which is the coordinator of the group,
+// and the leader of the partition 0 of the topic, which has the messages.
+func newMockConsumerGroupBroker(t *testing.T, group string, topic string, messages ...string) *kafka.MockBroker {
+	broker := kafka.NewMockBroker(t, 1)
+
+	// The assignment of the partition 0 of the topic, encoded as the protocol.
+	// The versions of the responses are the ones of the default version 0.10.2.
+	assignment := []byte{0, 0, 0, 0, 0, 1, 0, byte(len(topic))}
+	assignment = append(assignment, topic...)
+	assignment = append(assignment, 0, 0, 0, 1, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff)
+
+	fetch := kafka.NewMockFetchResponse(t, 1).SetVersion(3)
+	for i, msg := range messages {
+		fetch.SetMessage(topic, 0, int64(i), kafka.StringEncoder(msg))
+	}
+
+	broker.SetHandlerByMap(map[string]kafka.MockResponse{
+		"MetadataRequest": kafka.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+		"FindCoordinatorRequest": kafka.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(kafka.CoordinatorGroup, group, broker),
+		"JoinGroupRequest": kafka.NewMockWrapper(&kafka.JoinGroupResponse{
+			Version: 1, GenerationId: 1, MemberId: "member-1", LeaderId: "member-0",
+		}),
+		"SyncGroupRequest":  kafka.NewMockWrapper(&kafka.SyncGroupResponse{MemberAssignment: assignment}),
+		"HeartbeatRequest":  kafka.NewMockWrapper(&kafka.HeartbeatResponse{}),
+		"LeaveGroupRequest": kafka.NewMockWrapper(&kafka.LeaveGroupResponse{}),
+		"OffsetFetchRequest": kafka.NewMockOffsetFetchResponse(t).
+			SetOffset(group, topic, 0, 0, "", kafka.ErrNoError),
+		"OffsetCommitRequest": kafka.NewMockOffsetCommitResponse(t),
+		"OffsetRequest": kafka.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset(topic, 0, kafka.OffsetOldest, 0).
+			SetOffset(topic, 0, kafka.OffsetNewest, int64(len(messages))),
+		"FetchRequest": fetch,
+	})
+	return broker
+}
+
+func TestRunConsumerGroup(t *testing.T) {
+	broker := newMockConsumerGroupBroker(t, "group", "topic", "m0", "m1", "m2")
+	defer broker.Close()
+
+	kafkaConfig["mock"] = config.Kafka{
+		Name:     "mock",
+		Addrs:    []string{broker.Addr()},
+		Consumer: config.KafkaConsumer{GroupID: "group"},
+	}
+	defer delete(kafkaConfig, "mock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var handled []string
+	var failed bool
+
+	handler := ConsumerGroupHandlerFunc(func(ctx context.Context, msg *kafka.ConsumerMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// m1 fails once, and it's handled again before m2.
+		if string(msg.Value) == "m1" && !failed {
+			failed = true
+			return errors.New("failed")
+		}
+
+		handled = append(handled, string(msg.Value))
+		if len(handled) == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	err := RunConsumerGroup(ctx, "mock", []string{"topic"}, handler, ConsumerGroupRetryBackoff(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("RunConsumerGroup returns before the messages are handled, %v", ctx.Err())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 3 || handled[0] != "m0" || handled[1] != "m1" || handled[2] != "m2" {
+		t.Errorf("handled = %v", handled)
+	}
+}
+
+func TestRunConsumerGroupConfig(t *testing.T) {
+	if err := RunConsumerGroup(context.Background(), "missing", nil, nil); err != ErrConfigNotFound {
+		t.Errorf("RunConsumerGroup = %v; want %v", err, ErrConfigNotFound)
+	}
+
+	kafkaConfig["nogroup"] = config.Kafka{Name: "nogroup"}
+	defer delete(kafkaConfig, "nogroup")
+	if err := RunConsumerGroup(context.Background(), "nogroup", nil, nil); err != ErrGroupIDNotFound {
+		t.Errorf("RunConsumerGroup = %v; want %v", err, ErrGroupIDNotFound)
+	}
+}
+
+func TestConsumerGroupMaxAttempts(t *testing.T) {
+	var calls int
+	h := &consumerGroupHandler{
+		handler: ConsumerGroupHandlerFunc(func(ctx context.Context, msg *kafka.ConsumerMessage) error {
+			calls++
+			return errors.New("failed")
+		}),
+		retryBackoff: time.Millisecond,
+		maxAttempts:  3,
+	}
+
+	if err := h.handle(context.Background(), &kafka.ConsumerMessage{Topic: "topic"}); err != nil {
+		t.Errorf("handle = %v; want the message skipped", err)
+	}
+	if calls != 3 {
+		t.Errorf("handler is called %d times; want 3", calls)
+	}
+
+	// Without max attempts, the message is retried until the session is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	h.maxAttempts = 0
+	if err := h.handle(ctx, &kafka.ConsumerMessage{Topic: "topic"}); err != context.DeadlineExceeded {
+		t.Errorf("handle = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -17,6 +17,8 @@ var (
 var (
 	// ErrConfigNotFound ...
 	ErrConfigNotFound = errors.New("kafka config is not found")
+	// ErrHeadersUnsupported ...
+	ErrHeadersUnsupported = errors.New("kafka message headers require version 0.11.0.0 or later")
 )
 
 // Init ...
@@ -27,9 +29,13 @@ func Init(ctx context.Context, serviceName string, cfs []config.Kafka) {
 		var kcl kafka.Client
 		var err error
 		{
-			kConfig := kafka.NewConfig()
-			kConfig.Version = kafka.V0_10_2_0
-			kcl, err = kafka.NewClient(cf.Addrs, kConfig)
+			if cf.Version != "" {
+				if _, err = kafka.ParseKafkaVersion(cf.Version); err != nil {
+					log.Fatalw(ctx, "kafka.ParseKafkaVersion error", "conf", cf, "err", err)
+					continue
+				}
+			}
+			kcl, err = kafka.NewClient(cf.Addrs, newConfig(cf))
 			if err != nil {
 				log.Fatalw(ctx, "kafka.NewClient error", "conf", cf, "err", err)
 				continue
@@ -41,6 +47,31 @@ func Init(ctx context.Context, serviceName string, cfs []config.Kafka) {
 	}
 }
 
+func newConfig(cf config.Kafka) *kafka.Config {
+	kConfig := kafka.NewConfig()
+	kConfig.Version = kafka.V0_10_2_0
+	if cf.Version != "" {
+		if v, err := kafka.ParseKafkaVersion(cf.Version); err == nil {
+			kConfig.Version = v
+		}
+	}
+	return kConfig
+}
+
+// CheckHeadersSupported returns ErrHeadersUnsupported if the version of the kafka
+// instance `name` is earlier than 0.11.0.0, whose producer rejects the messages with headers.
+func CheckHeadersSupported(name string) error {
+	kcf, ok := kafkaConfig[name]
+	if !ok {
+		return ErrConfigNotFound
+	}
+
+	if !newConfig(kcf).Version.IsAtLeast(kafka.V0_11_0_0) {
+		return ErrHeadersUnsupported
+	}
+	return nil
+}
+
 // NewConsumer ...
 func NewConsumer(ctx context.Context, name string) (kafka.Consumer, error) {
 	kcl, ok := kafkaMap[name]
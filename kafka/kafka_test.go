@@ -3,8 +3,10 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"testing"
+	"time"
 
 	kafka "github.com/Shopify/sarama"
 	"github.com/WiFeng/go-sky/config"
@@ -14,13 +16,18 @@ import (
 var (
 	testName    = "testKafka"
 	testService = "testService"
+	testAddr    = "localhost:9092"
+
+	// testBroker is whether the broker of testAddr is available. The tests
+	// of it are skipped without it, the others use the mock brokers.
+	testBroker bool
 )
 
 func TestMain(m *testing.M) {
 	kafkaConf := []config.Kafka{
 		{
 			Name:  testName,
-			Addrs: []string{"localhost:9092"},
+			Addrs: []string{testAddr},
 		},
 	}
 
@@ -31,12 +38,26 @@ func TestMain(m *testing.M) {
 		fmt.Println("Error:", err)
 	}
 
-	Init(context.Background(), testService, kafkaConf)
+	if conn, err := net.DialTimeout("tcp", testAddr, time.Second); err != nil {
+		fmt.Println("Skip the tests of the broker:", err)
+	} else {
+		conn.Close()
+		testBroker = true
+		Init(context.Background(), testService, kafkaConf)
+	}
 
 	os.Exit(m.Run())
 }
 
+func skipWithoutBroker(t *testing.T) {
+	t.Helper()
+	if !testBroker {
+		t.Skip("kafka broker " + testAddr + " is not available")
+	}
+}
+
 func TestNewAsyncProducer(t *testing.T) {
+	skipWithoutBroker(t)
 	_, err := NewAsyncProducer(context.Background(), testName)
 	if err != nil {
 		t.Error(err)
@@ -44,6 +65,7 @@ func TestNewAsyncProducer(t *testing.T) {
 }
 
 func TestSyncProducerSendMessage(t *testing.T) {
+	skipWithoutBroker(t)
 	producer, err := NewSyncProducer(context.Background(), testName)
 	if err != nil {
 		t.Error(err)
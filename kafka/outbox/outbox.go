@@ -0,0 +1,411 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/WiFeng/go-sky/database"
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+
+	skykafka "github.com/WiFeng/go-sky/kafka"
+)
+
+const (
+	// DefaultTable ...
+	DefaultTable = "sky_outbox"
+
+	statusPending = 0
+	statusSent    = 1
+	statusClaimed = 2
+)
+
+// CreateTableSQL is the MySQL schema of the outbox table, `%s` is the table name.
+// Only MySQL is supported, the statements of Add and Relay use its dialect, e.g.
+// the `?` placeholders, NOW(3) and DELETE ... LIMIT.
+const CreateTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  topic VARCHAR(255) NOT NULL,
+  msg_key VARBINARY(1024) NULL,
+  payload LONGBLOB NOT NULL,
+  headers TEXT NULL,
+  status TINYINT NOT NULL DEFAULT 0,
+  created_at DATETIME(3) NOT NULL,
+  claimed_at DATETIME(3) NULL,
+  sent_at DATETIME(3) NULL,
+  PRIMARY KEY (id),
+  KEY idx_status_id (status, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+
+var (
+	// ErrEmptyTopic ...
+	ErrEmptyTopic = errors.New("outbox message topic is empty")
+	// ErrUnsupportedDriver ...
+	ErrUnsupportedDriver = errors.New("outbox supports only the mysql database")
+)
+
+// Message ...
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Option ...
+type Option func(*options)
+
+type options struct {
+	table        string
+	batchSize    int
+	interval     time.Duration
+	claimTimeout time.Duration
+	cleanupAfter time.Duration
+}
+
+func newOptions(opt ...Option) options {
+	o := options{
+		table:        DefaultTable,
+		batchSize:    100,
+		interval:     time.Second,
+		claimTimeout: time.Minute,
+	}
+	for _, f := range opt {
+		f(&o)
+	}
+	return o
+}
+
+// WithTable sets the outbox table name, DefaultTable is used if not set.
+func WithTable(table string) Option {
+	return func(o *options) {
+		o.table = table
+	}
+}
+
+// WithBatchSize sets how many messages the relay publishes in a round.
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		o.batchSize = n
+	}
+}
+
+// WithInterval sets the wait time of the relay between two rounds.
+func WithInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// WithClaimTimeout sets how long the messages claimed by a relay are not published
+// by the others, after which they are claimed again, e.g. if the relay is down.
+func WithClaimTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.claimTimeout = d
+	}
+}
+
+// WithCleanupAfter makes the relay delete the sent messages older than d.
+func WithCleanupAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.cleanupAfter = d
+	}
+}
+
+// Add inserts msg into the outbox table within tx, so that the message
+// is published only if tx is committed. tx must be of a mysql database.
+func Add(ctx context.Context, tx *sql.Tx, msg *Message, opt ...Option) error {
+	if msg.Topic == "" {
+		return ErrEmptyTopic
+	}
+
+	o := newOptions(opt...)
+
+	var headers []byte
+	if len(msg.Headers) > 0 {
+		var err error
+		if headers, err = json.Marshal(msg.Headers); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (topic, msg_key, payload, headers, status, created_at) VALUES (?, ?, ?, ?, ?, NOW(3))", o.table)
+	if _, err := tx.ExecContext(ctx, query, msg.Topic, msg.Key, msg.Value, headers, statusPending); err != nil {
+		log.Errorw(ctx, "outbox.Add error", "table", o.table, "topic", msg.Topic, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Relay publishes the pending messages of an outbox table of a mysql database in
+// order, at least once. The relays of several processes may run on the same table.
+// It's designed to be registered by sky.RegisterTask(relay.Run, relay.Stop, false).
+type Relay struct {
+	dbName   string
+	db       *sql.DB
+	producer skykafka.SyncProducer
+	opts     options
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	started int32
+}
+
+// NewRelay returns ErrHeadersUnsupported if the version of the kafka instance is
+// earlier than 0.11.0.0, which can't publish the messages with headers, and
+// ErrUnsupportedDriver if the database instance is not mysql.
+func NewRelay(ctx context.Context, dbName string, kafkaName string, opt ...Option) (*Relay, error) {
+	db, err := database.GetInstance(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := database.GetConfig(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	if cf.Driver != "mysql" {
+		log.Errorw(ctx, "outbox.NewRelay, unsupported driver", "db_name", dbName, "driver", cf.Driver, "err", ErrUnsupportedDriver)
+		return nil, ErrUnsupportedDriver
+	}
+
+	if err = skykafka.CheckHeadersSupported(kafkaName); err != nil {
+		log.Errorw(ctx, "outbox.NewRelay, kafka.CheckHeadersSupported error", "kafka_name", kafkaName, "err", err)
+		return nil, err
+	}
+
+	producer, err := skykafka.NewSyncProducer(ctx, kafkaName)
+	if err != nil {
+		log.Errorw(ctx, "outbox.NewRelay, kafka.NewSyncProducer error", "kafka_name", kafkaName, "err", err)
+		return nil, err
+	}
+
+	rctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{
+		dbName:   dbName,
+		db:       db,
+		producer: producer,
+		opts:     newOptions(opt...),
+		ctx:      rctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	return r, nil
+}
+
+// Run publishes the pending messages until Stop is called.
+// It returns immediately if it's already started, or the relay is stopped.
+func (r *Relay) Run() {
+	if !atomic.CompareAndSwapInt32(&r.started, 0, 1) {
+		return
+	}
+	defer close(r.done)
+
+	// A round in progress is not interrupted by Stop, otherwise the
+	// messages already published could not be marked as sent.
+	var ctx = context.Background()
+
+	log.Infow(ctx, "outbox relay start", "db_name", r.dbName, "table", r.opts.table)
+	for {
+		n, err := r.publish(ctx)
+		if err != nil {
+			log.Errorw(ctx, "outbox relay publish error", "db_name", r.dbName, "table", r.opts.table, "err", err)
+		}
+
+		r.report(ctx)
+		r.cleanup(ctx)
+
+		// Go on immediately while there is a backlog.
+		wait := r.opts.interval
+		if err == nil && n >= r.opts.batchSize {
+			wait = 0
+		}
+
+		select {
+		case <-r.ctx.Done():
+			log.Infow(ctx, "outbox relay exit", "db_name", r.dbName, "table", r.opts.table)
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Stop stops Run and waits for the round in progress.
+// Run is never started after Stop is called.
+func (r *Relay) Stop() {
+	r.cancel()
+	if atomic.CompareAndSwapInt32(&r.started, 0, 1) {
+		return
+	}
+	<-r.done
+}
+
+// publish sends one batch of pending messages. The messages are claimed in a short
+// transaction first, so that the relays of other processes skip them, and no row is
+// locked while they are sent. The claims of a failed relay expire by claimTimeout.
+func (r *Relay) publish(ctx context.Context) (n int, err error) {
+	span := opentracing.GlobalTracer().StartSpan(
+		"outbox.Relay.Publish",
+		opentracing.Tag{Key: "outbox.table", Value: r.opts.table},
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "outbox"},
+	)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	defer func() {
+		span.SetTag("outbox.count", n)
+		if err != nil {
+			opentracingext.Error.Set(span, true)
+			span.SetTag("outbox.error", err.Error())
+		}
+		span.Finish()
+	}()
+
+	claimed, err := r.claim(ctx)
+	if err != nil || len(claimed) == 0 {
+		return 0, err
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET status = ?, sent_at = NOW(3) WHERE id = ? AND status = ?", r.opts.table)
+	for i, rw := range claimed {
+		// Stop at the first failure to keep the order of messages, and
+		// release the rest, so that they are published in the next round.
+		if _, _, err = r.producer.SendMessageContext(ctx, producerMessage(ctx, rw.id, rw.msg, rw.headers)); err != nil {
+			skyprome.OutboxPublishTotalCounter(r.dbName, r.opts.table, rw.msg.Topic, "error")
+			r.release(ctx, claimed[i:])
+			return n, err
+		}
+		skyprome.OutboxPublishTotalCounter(r.dbName, r.opts.table, rw.msg.Topic, "success")
+
+		if _, err = r.db.ExecContext(ctx, update, statusSent, rw.id, statusClaimed); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+type outboxRow struct {
+	id      int64
+	msg     Message
+	headers []byte
+}
+
+// claim marks the next batch of messages as claimed, in order. It stops at the first
+// message claimed by another relay, which is publishing the earlier messages.
+func (r *Relay) claim(ctx context.Context) ([]outboxRow, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("SELECT id, topic, msg_key, payload, headers, status = ? AND claimed_at > NOW(3) - INTERVAL ? MICROSECOND "+
+		"FROM %s WHERE status IN (?, ?) ORDER BY id LIMIT ? FOR UPDATE", r.opts.table)
+	rows, err := tx.QueryContext(ctx, query, statusClaimed, r.opts.claimTimeout.Microseconds(), statusPending, statusClaimed, r.opts.batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []outboxRow
+	var ids []int64
+	for rows.Next() {
+		var rw outboxRow
+		var busy bool
+		if err = rows.Scan(&rw.id, &rw.msg.Topic, &rw.msg.Key, &rw.msg.Value, &rw.headers, &busy); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if busy {
+			break
+		}
+		claimed = append(claimed, rw)
+		ids = append(ids, rw.id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+
+	update, args, err := database.In(fmt.Sprintf("UPDATE %s SET status = ?, claimed_at = NOW(3) WHERE id IN (?)", r.opts.table), statusClaimed, ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, update, args...); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// release marks the claimed messages as pending again.
+func (r *Relay) release(ctx context.Context, claimed []outboxRow) {
+	ids := make([]int64, 0, len(claimed))
+	for _, rw := range claimed {
+		ids = append(ids, rw.id)
+	}
+
+	update, args, err := database.In(fmt.Sprintf("UPDATE %s SET status = ?, claimed_at = NULL WHERE id IN (?) AND status = ?", r.opts.table), statusPending, ids, statusClaimed)
+	if err == nil {
+		_, err = r.db.ExecContext(ctx, update, args...)
+	}
+	if err != nil {
+		log.Warnw(ctx, "outbox relay release error", "db_name", r.dbName, "table", r.opts.table, "err", err)
+	}
+}
+
+func producerMessage(ctx context.Context, id int64, msg Message, headers []byte) *kafka.ProducerMessage {
+	pmsg := &kafka.ProducerMessage{
+		Topic: msg.Topic,
+		Value: kafka.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		pmsg.Key = kafka.ByteEncoder(msg.Key)
+	}
+	if len(headers) > 0 {
+		var hds map[string]string
+		if err := json.Unmarshal(headers, &hds); err != nil {
+			log.Warnw(ctx, "outbox relay decode headers error", "id", id, "err", err)
+		}
+		for k, v := range hds {
+			pmsg.Headers = append(pmsg.Headers, kafka.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+	return pmsg
+}
+
+func (r *Relay) report(ctx context.Context) {
+	var pending int64
+	var age float64
+
+	query := fmt.Sprintf("SELECT COUNT(*), COALESCE(TIMESTAMPDIFF(MICROSECOND, MIN(created_at), NOW(3)), 0) / 1000000 FROM %s WHERE status IN (?, ?)", r.opts.table)
+	if err := r.db.QueryRowContext(ctx, query, statusPending, statusClaimed).Scan(&pending, &age); err != nil {
+		log.Warnw(ctx, "outbox relay report error", "db_name", r.dbName, "table", r.opts.table, "err", err)
+		return
+	}
+
+	skyprome.OutboxPendingGauge(r.dbName, r.opts.table, pending, age)
+}
+
+func (r *Relay) cleanup(ctx context.Context) {
+	if r.opts.cleanupAfter <= 0 {
+		return
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE status = ? AND sent_at < NOW(3) - INTERVAL ? SECOND LIMIT %d", r.opts.table, r.opts.batchSize)
+	if _, err := r.db.ExecContext(ctx, query, statusSent, int64(r.opts.cleanupAfter.Seconds())); err != nil {
+		log.Warnw(ctx, "outbox relay cleanup error", "db_name", r.dbName, "table", r.opts.table, "err", err)
+	}
+}
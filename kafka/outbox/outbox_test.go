@@ -0,0 +1,385 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/log"
+
+	skykafka "github.com/WiFeng/go-sky/kafka"
+)
+
+func TestMain(m *testing.M) {
+	logConf := config.Log{
+		Level: "info",
+	}
+	if _, err := log.Init(context.Background(), "testService", logConf); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	sql.Register("outboxfake", testDriver)
+
+	os.Exit(m.Run())
+}
+
+// testRow is a row of the outbox table of the test driver.
+type testRow struct {
+	id      int64
+	topic   string
+	key     []byte
+	payload []byte
+	headers []byte
+	status  int64
+	claimed time.Time
+}
+
+// testDriver is an in-process driver, which supports only the statements of
+// the outbox table on the rows. The transactions are not isolated, but the
+// ones in progress are counted.
+var testDriver = &fakeDriver{}
+
+type fakeDriver struct {
+	mu   sync.Mutex
+	rows []*testRow
+	inTx int
+}
+
+func (d *fakeDriver) reset() {
+	d.mu.Lock()
+	d.rows = nil
+	d.inTx = 0
+	d.mu.Unlock()
+}
+
+func (d *fakeDriver) txInProgress() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inTx
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{driver: d}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake: prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.driver.mu.Lock()
+	c.driver.inTx++
+	c.driver.mu.Unlock()
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return c.Rollback()
+}
+
+func (c *fakeConn) Rollback() error {
+	c.driver.mu.Lock()
+	c.driver.inTx--
+	c.driver.mu.Unlock()
+	return nil
+}
+
+// ids returns the values of the args as the ids.
+func ids(args []driver.NamedValue) map[int64]bool {
+	m := map[int64]bool{}
+	for _, arg := range args {
+		m[arg.Value.(int64)] = true
+	}
+	return m
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	d := c.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO "+DefaultTable+" "):
+		rw := &testRow{id: int64(len(d.rows) + 1)}
+		rw.topic, _ = args[0].Value.(string)
+		rw.key, _ = args[1].Value.([]byte)
+		rw.payload, _ = args[2].Value.([]byte)
+		rw.headers, _ = args[3].Value.([]byte)
+		rw.status, _ = args[4].Value.(int64)
+		d.rows = append(d.rows, rw)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE "+DefaultTable+" SET status = ?, claimed_at = NOW(3) WHERE id IN ("):
+		claim := ids(args[1:])
+		for _, rw := range d.rows {
+			if claim[rw.id] {
+				rw.status, rw.claimed = args[0].Value.(int64), time.Now()
+			}
+		}
+		return driver.RowsAffected(len(claim)), nil
+	case strings.HasPrefix(query, "UPDATE "+DefaultTable+" SET status = ?, claimed_at = NULL WHERE id IN ("):
+		release := ids(args[1 : len(args)-1])
+		for _, rw := range d.rows {
+			if release[rw.id] && rw.status == args[len(args)-1].Value.(int64) {
+				rw.status, rw.claimed = args[0].Value.(int64), time.Time{}
+			}
+		}
+		return driver.RowsAffected(len(release)), nil
+	case strings.HasPrefix(query, "UPDATE "+DefaultTable+" SET status = ?, sent_at = NOW(3) WHERE id = ? AND status = ?"):
+		for _, rw := range d.rows {
+			if rw.id == args[1].Value.(int64) && rw.status == args[2].Value.(int64) {
+				rw.status = args[0].Value.(int64)
+				return driver.RowsAffected(1), nil
+			}
+		}
+		return driver.RowsAffected(0), nil
+	}
+	return nil, errors.New("fake: unsupported exec " + query)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT id, topic, msg_key, payload, headers, status = ? AND claimed_at > NOW(3) - INTERVAL ? MICROSECOND FROM "+DefaultTable+" WHERE status IN (?, ?)") {
+		return nil, errors.New("fake: unsupported query " + query)
+	}
+
+	d := c.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	claimed := args[0].Value.(int64)
+	since := time.Now().Add(-time.Duration(args[1].Value.(int64)) * time.Microsecond)
+	rows := &fakeRows{}
+	for _, rw := range d.rows {
+		if (rw.status == args[2].Value.(int64) || rw.status == args[3].Value.(int64)) && int64(len(rows.values)) < args[4].Value.(int64) {
+			busy := rw.status == claimed && rw.claimed.After(since)
+			rows.values = append(rows.values, []driver.Value{rw.id, rw.topic, rw.key, rw.payload, rw.headers, busy})
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+	pos    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "topic", "msg_key", "payload", "headers", "busy"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
+
+// testProducer records the messages sent, it fails the topic failTopic.
+type testProducer struct {
+	skykafka.SyncProducer
+	sent      []*kafka.ProducerMessage
+	failTopic string
+	inTx      int
+}
+
+func (p *testProducer) SendMessageContext(ctx context.Context, msg *kafka.ProducerMessage) (int32, int64, error) {
+	p.inTx += testDriver.txInProgress()
+	if msg.Topic == p.failTopic {
+		return 0, 0, errors.New("produce failed")
+	}
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent)), nil
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	testDriver.reset()
+
+	db, err := sql.Open("outboxfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func addMessages(t *testing.T, db *sql.DB, msgs ...*Message) {
+	t.Helper()
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range msgs {
+		if err = Add(ctx, tx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if err = Add(ctx, tx, &Message{Value: []byte("v")}); err != ErrEmptyTopic {
+		t.Errorf("Add without topic = %v; want %v", err, ErrEmptyTopic)
+	}
+	if err = Add(ctx, tx, &Message{Topic: "orders"}, WithTable("missing")); err == nil {
+		t.Error("Add to the missing table = nil; want an error")
+	}
+	if err = Add(ctx, tx, &Message{Topic: "orders", Key: []byte("k"), Value: []byte("v"), Headers: map[string]string{"h": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(testDriver.rows) != 1 {
+		t.Fatalf("rows = %d; want 1", len(testDriver.rows))
+	}
+	rw := testDriver.rows[0]
+	if rw.topic != "orders" || string(rw.key) != "k" || string(rw.payload) != "v" ||
+		string(rw.headers) != `{"h":"1"}` || rw.status != statusPending {
+		t.Errorf("row = %+v", rw)
+	}
+}
+
+func TestRelayPublish(t *testing.T) {
+	db := openTestDB(t)
+	addMessages(t, db,
+		&Message{Topic: "t1", Value: []byte("m1")},
+		&Message{Topic: "t2", Key: []byte("k2"), Value: []byte("m2"), Headers: map[string]string{"h": "2"}},
+		&Message{Topic: "fail", Value: []byte("m3")},
+		&Message{Topic: "t1", Value: []byte("m4")},
+	)
+
+	producer := &testProducer{failTopic: "fail"}
+	r := &Relay{dbName: "db1", db: db, producer: producer, opts: newOptions(WithBatchSize(10))}
+
+	// The messages are published in order, and the relay stops at the first failure.
+	n, err := r.publish(context.Background())
+	if n != 2 || err == nil {
+		t.Fatalf("publish = %d, %v; want 2 and an error", n, err)
+	}
+	if len(producer.sent) != 2 || producer.sent[0].Topic != "t1" || producer.sent[1].Topic != "t2" {
+		t.Fatalf("sent = %+v", producer.sent)
+	}
+	if producer.inTx != 0 {
+		t.Error("messages are sent in a transaction")
+	}
+	if key, _ := producer.sent[1].Key.Encode(); string(key) != "k2" {
+		t.Errorf("key = %s; want k2", key)
+	}
+	if hds := producer.sent[1].Headers; len(hds) != 1 || string(hds[0].Key) != "h" || string(hds[0].Value) != "2" {
+		t.Errorf("headers = %+v", hds)
+	}
+	for i, want := range []int64{statusSent, statusSent, statusPending, statusPending} {
+		if testDriver.rows[i].status != want {
+			t.Errorf("row %d status = %d; want %d", i+1, testDriver.rows[i].status, want)
+		}
+	}
+
+	// The failed message is published again before the next ones.
+	producer.failTopic = ""
+	if n, err = r.publish(context.Background()); n != 2 || err != nil {
+		t.Fatalf("publish = %d, %v; want 2", n, err)
+	}
+	if len(producer.sent) != 4 || producer.sent[2].Topic != "fail" || producer.sent[3].Topic != "t1" {
+		t.Fatalf("sent = %+v", producer.sent)
+	}
+	for i, rw := range testDriver.rows {
+		if rw.status != statusSent {
+			t.Errorf("row %d status = %d; want %d", i+1, rw.status, statusSent)
+		}
+	}
+}
+
+func TestRelayClaim(t *testing.T) {
+	db := openTestDB(t)
+	addMessages(t, db,
+		&Message{Topic: "t1", Value: []byte("m1")},
+		&Message{Topic: "t2", Value: []byte("m2")},
+		&Message{Topic: "t3", Value: []byte("m3")},
+	)
+
+	// The message 2 is claimed by another relay, which is publishing it.
+	testDriver.rows[1].status, testDriver.rows[1].claimed = statusClaimed, time.Now()
+
+	producer := &testProducer{}
+	r := &Relay{dbName: "db1", db: db, producer: producer, opts: newOptions(WithBatchSize(10), WithClaimTimeout(time.Minute))}
+
+	// The messages after the claimed one wait for it, to keep the order.
+	if n, err := r.publish(context.Background()); n != 1 || err != nil {
+		t.Fatalf("publish = %d, %v; want 1", n, err)
+	}
+	if len(producer.sent) != 1 || producer.sent[0].Topic != "t1" {
+		t.Fatalf("sent = %+v", producer.sent)
+	}
+	if n, err := r.publish(context.Background()); n != 0 || err != nil {
+		t.Fatalf("publish = %d, %v; want 0", n, err)
+	}
+
+	// The claim expires, e.g. the other relay is down.
+	testDriver.rows[1].claimed = time.Now().Add(-2 * time.Minute)
+	if n, err := r.publish(context.Background()); n != 2 || err != nil {
+		t.Fatalf("publish = %d, %v; want 2", n, err)
+	}
+	if len(producer.sent) != 3 || producer.sent[1].Topic != "t2" || producer.sent[2].Topic != "t3" {
+		t.Fatalf("sent = %+v", producer.sent)
+	}
+	for i, rw := range testDriver.rows {
+		if rw.status != statusSent {
+			t.Errorf("row %d status = %d; want %d", i+1, rw.status, statusSent)
+		}
+	}
+}
+
+func TestRelayStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+
+	stopped := make(chan struct{})
+	go func() {
+		r.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocks without Run")
+	}
+
+	// Run is not started after Stop.
+	r.Run()
+}
@@ -0,0 +1,261 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
+)
+
+const (
+	// HeaderOriginalTopic ...
+	HeaderOriginalTopic = "x-sky-original-topic"
+	// HeaderOriginalPartition ...
+	HeaderOriginalPartition = "x-sky-original-partition"
+	// HeaderOriginalOffset ...
+	HeaderOriginalOffset = "x-sky-original-offset"
+	// HeaderRetryCount ...
+	HeaderRetryCount = "x-sky-retry-count"
+	// HeaderError ...
+	HeaderError = "x-sky-error"
+	// HeaderFailedAt ...
+	HeaderFailedAt = "x-sky-failed-at"
+)
+
+var (
+	// ErrSessionDone ...
+	ErrSessionDone = errors.New("kafka consumer group session is done")
+)
+
+// RetryHandler handles a message in place for a few attempts with backoff, then
+// forwards it to `<topic>.retry.N` and finally to `<topic>.dlq`, according to the
+// retry config of the kafka instance.
+type RetryHandler struct {
+	name     string
+	cf       config.KafkaRetry
+	handler  ConsumerGroupHandler
+	producer SyncProducer
+}
+
+// NewRetryHandler wraps handler with the retry policy of the kafka instance `name`.
+// Failed messages are forwarded through the instrumented SyncProducer of the same instance,
+// with the retry metadata in the headers, so the version must be 0.11.0.0 or later
+// unless the failed messages are not forwarded at all.
+func NewRetryHandler(ctx context.Context, name string, handler ConsumerGroupHandler) (*RetryHandler, error) {
+	kcf, ok := kafkaConfig[name]
+	if !ok {
+		return nil, ErrConfigNotFound
+	}
+
+	cf := kcf.Consumer.Retry
+
+	var producer SyncProducer
+	if cf.Topics > 0 || !cf.DisableDeadLetter {
+		if err := CheckHeadersSupported(name); err != nil {
+			log.Errorw(ctx, "kafka.NewRetryHandler, version error", "name", name, "version", kcf.Version, "err", err)
+			return nil, err
+		}
+
+		var err error
+		if producer, err = NewSyncProducer(ctx, name); err != nil {
+			log.Errorw(ctx, "kafka.NewRetryHandler, NewSyncProducer error", "name", name, "err", err)
+			return nil, err
+		}
+	}
+
+	return newRetryHandler(name, cf, handler, producer), nil
+}
+
+func newRetryHandler(name string, cf config.KafkaRetry, handler ConsumerGroupHandler, producer SyncProducer) *RetryHandler {
+	if cf.Attempts < 1 {
+		cf.Attempts = 3
+	}
+	if cf.BackoffMillSec < 1 {
+		cf.BackoffMillSec = 100
+	}
+	if cf.MaxBackoffMillSec < cf.BackoffMillSec {
+		cf.MaxBackoffMillSec = 5000
+	}
+	if cf.TopicSuffix == "" {
+		cf.TopicSuffix = ".retry"
+	}
+	if cf.DeadLetterSuffix == "" {
+		cf.DeadLetterSuffix = ".dlq"
+	}
+
+	return &RetryHandler{
+		name:     name,
+		cf:       cf,
+		handler:  handler,
+		producer: producer,
+	}
+}
+
+// Topics returns topics and all of their retry topics, which should be consumed together.
+func (h *RetryHandler) Topics(topics ...string) []string {
+	var all []string
+	for _, topic := range topics {
+		all = append(all, topic)
+		for i := 1; i <= h.cf.Topics; i++ {
+			all = append(all, h.retryTopic(topic, i))
+		}
+	}
+	return all
+}
+
+// Handle ...
+func (h *RetryHandler) Handle(ctx context.Context, msg *kafka.ConsumerMessage) error {
+	topic, stage := h.parseTopic(msg.Topic)
+
+	// Messages of retry topics are delayed before being handled again.
+	if stage > 0 && h.cf.TopicDelayMillSec > 0 && !msg.Timestamp.IsZero() {
+		delay := time.Duration(h.cf.TopicDelayMillSec*stage) * time.Millisecond
+		if err := h.wait(ctx, time.Until(msg.Timestamp.Add(delay))); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	backoff := time.Duration(h.cf.BackoffMillSec) * time.Millisecond
+	maxBackoff := time.Duration(h.cf.MaxBackoffMillSec) * time.Millisecond
+	for attempt := 1; attempt <= h.cf.Attempts; attempt++ {
+		if err = h.handler.Handle(ctx, msg); err == nil {
+			return nil
+		}
+		if attempt == h.cf.Attempts {
+			break
+		}
+
+		log.Warnw(ctx, "kafka handler error, retry in place", "name", h.name, "topic", msg.Topic,
+			"partition", msg.Partition, "offset", msg.Offset, "attempt", attempt, "err", err)
+		skyprome.KafkaConsumerRetryTotalCounter(h.name, topic, "inplace")
+
+		if werr := h.wait(ctx, backoff); werr != nil {
+			return werr
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	if stage < h.cf.Topics {
+		if ferr := h.forward(ctx, msg, h.retryTopic(topic, stage+1), stage+1, err); ferr != nil {
+			return ferr
+		}
+		skyprome.KafkaConsumerRetryTotalCounter(h.name, topic, "topic")
+		return nil
+	}
+
+	if h.cf.DisableDeadLetter {
+		return err
+	}
+
+	if ferr := h.forward(ctx, msg, topic+h.cf.DeadLetterSuffix, stage, err); ferr != nil {
+		return ferr
+	}
+	skyprome.KafkaConsumerDeadLetterTotalCounter(h.name, topic)
+	return nil
+}
+
+func (h *RetryHandler) forward(ctx context.Context, msg *kafka.ConsumerMessage, target string, retryCount int, cause error) error {
+	pmsg := &kafka.ProducerMessage{
+		Topic:   target,
+		Headers: forwardHeaders(msg, retryCount, cause),
+	}
+	if msg.Key != nil {
+		pmsg.Key = kafka.ByteEncoder(msg.Key)
+	}
+	if msg.Value != nil {
+		pmsg.Value = kafka.ByteEncoder(msg.Value)
+	}
+
+	if _, _, err := h.producer.SendMessageContext(ctx, pmsg); err != nil {
+		log.Errorw(ctx, "kafka forward message error", "name", h.name, "topic", msg.Topic, "partition", msg.Partition,
+			"offset", msg.Offset, "target", target, "err", err)
+		return err
+	}
+
+	log.Warnw(ctx, "kafka forward message", "name", h.name, "topic", msg.Topic, "partition", msg.Partition,
+		"offset", msg.Offset, "target", target, "err", cause)
+	return nil
+}
+
+func (h *RetryHandler) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-sessionDone(ctx):
+		return ErrSessionDone
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func (h *RetryHandler) retryTopic(topic string, stage int) string {
+	return fmt.Sprintf("%s%s.%d", topic, h.cf.TopicSuffix, stage)
+}
+
+// parseTopic returns the original topic and the retry stage of topic.
+func (h *RetryHandler) parseTopic(topic string) (string, int) {
+	i := strings.LastIndex(topic, h.cf.TopicSuffix+".")
+	if i < 0 {
+		return topic, 0
+	}
+
+	stage, err := strconv.Atoi(topic[i+len(h.cf.TopicSuffix)+1:])
+	if err != nil || stage < 1 {
+		return topic, 0
+	}
+	return topic[:i], stage
+}
+
+// forwardHeaders keeps the headers of msg, adds where it comes from
+// on the first forward and replaces the error metadata.
+func forwardHeaders(msg *kafka.ConsumerMessage, retryCount int, cause error) []kafka.RecordHeader {
+	var headers []kafka.RecordHeader
+	var hasOrigin bool
+
+	for _, hd := range msg.Headers {
+		if hd == nil {
+			continue
+		}
+		switch string(hd.Key) {
+		case HeaderRetryCount, HeaderError, HeaderFailedAt:
+			continue
+		case HeaderOriginalTopic:
+			hasOrigin = true
+		}
+		headers = append(headers, *hd)
+	}
+
+	if !hasOrigin {
+		headers = append(headers,
+			kafka.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+			kafka.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+			kafka.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		)
+	}
+
+	var errMsg string
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+
+	headers = append(headers,
+		kafka.RecordHeader{Key: []byte(HeaderRetryCount), Value: []byte(strconv.Itoa(retryCount))},
+		kafka.RecordHeader{Key: []byte(HeaderError), Value: []byte(errMsg)},
+		kafka.RecordHeader{Key: []byte(HeaderFailedAt), Value: []byte(time.Now().Format(time.RFC3339))},
+	)
+	return headers
+}
@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/WiFeng/go-sky/config"
+)
+
+// testProducer records the messages sent, instead of producing them.
+type testProducer struct {
+	kafka.SyncProducer
+	sent []*kafka.ProducerMessage
+	err  error
+}
+
+func (p *testProducer) Use(ctx context.Context, mwf ...interface{}) {}
+
+func (p *testProducer) SendMessageContext(ctx context.Context, msg *kafka.ProducerMessage) (int32, int64, error) {
+	if p.err != nil {
+		return 0, 0, p.err
+	}
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent)), nil
+}
+
+func header(headers []kafka.RecordHeader, key string) (string, bool) {
+	for _, hd := range headers {
+		if string(hd.Key) == key {
+			return string(hd.Value), true
+		}
+	}
+	return "", false
+}
+
+func TestParseTopic(t *testing.T) {
+	h := newRetryHandler("test", config.KafkaRetry{}, nil, nil)
+
+	cases := []struct {
+		topic string
+		orig  string
+		stage int
+	}{
+		{"orders", "orders", 0},
+		{"orders.retry.1", "orders", 1},
+		{"orders.retry.12", "orders", 12},
+		{"orders.retry.x", "orders.retry.x", 0},
+		{"orders.retry.0", "orders.retry.0", 0},
+		{"orders.retry.1.retry.2", "orders.retry.1", 2},
+	}
+	for _, c := range cases {
+		if orig, stage := h.parseTopic(c.topic); orig != c.orig || stage != c.stage {
+			t.Errorf("parseTopic(%s) = %s, %d; want %s, %d", c.topic, orig, stage, c.orig, c.stage)
+		}
+	}
+
+	if topic := h.retryTopic("orders", 2); topic != "orders.retry.2" {
+		t.Errorf("retryTopic = %s", topic)
+	}
+}
+
+func TestForwardHeaders(t *testing.T) {
+	msg := &kafka.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Headers: []*kafka.RecordHeader{
+			{Key: []byte("trace"), Value: []byte("t1")},
+			nil,
+		},
+	}
+
+	headers := forwardHeaders(msg, 1, errors.New("boom"))
+	for key, want := range map[string]string{
+		"trace":                 "t1",
+		HeaderOriginalTopic:     "orders",
+		HeaderOriginalPartition: "3",
+		HeaderOriginalOffset:    "42",
+		HeaderRetryCount:        "1",
+		HeaderError:             "boom",
+	} {
+		if v, _ := header(headers, key); v != want {
+			t.Errorf("header %s = %q; want %q", key, v, want)
+		}
+	}
+
+	// The origin is kept, and the error metadata is replaced on the next forward.
+	retried := &kafka.ConsumerMessage{Topic: "orders.retry.1", Partition: 0, Offset: 7}
+	for i := range headers {
+		retried.Headers = append(retried.Headers, &headers[i])
+	}
+	headers = forwardHeaders(retried, 2, nil)
+
+	var retryCounts int
+	for _, hd := range headers {
+		if string(hd.Key) == HeaderRetryCount {
+			retryCounts++
+		}
+	}
+	if retryCounts != 1 {
+		t.Errorf("%d retry count headers; want 1", retryCounts)
+	}
+	if v, _ := header(headers, HeaderOriginalTopic); v != "orders" {
+		t.Errorf("original topic = %s; want orders", v)
+	}
+	if v, _ := header(headers, HeaderOriginalOffset); v != "42" {
+		t.Errorf("original offset = %s; want 42", v)
+	}
+	if v, _ := header(headers, HeaderRetryCount); v != "2" {
+		t.Errorf("retry count = %s; want 2", v)
+	}
+	if v, ok := header(headers, HeaderError); !ok || v != "" {
+		t.Errorf("error = %q, %v; want empty", v, ok)
+	}
+}
+
+func TestRetryHandlerHandle(t *testing.T) {
+	var calls []time.Time
+	failing := ConsumerGroupHandlerFunc(func(ctx context.Context, msg *kafka.ConsumerMessage) error {
+		calls = append(calls, time.Now())
+		return errors.New("failed")
+	})
+
+	producer := &testProducer{}
+	h := newRetryHandler("test", config.KafkaRetry{
+		Attempts:          3,
+		BackoffMillSec:    10,
+		MaxBackoffMillSec: 15,
+		Topics:            1,
+	}, failing, producer)
+
+	// The message of the original topic is forwarded to the retry topic after the attempts.
+	msg := &kafka.ConsumerMessage{Topic: "orders", Value: []byte("v")}
+	if err := h.Handle(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("handler is called %d times; want 3", len(calls))
+	}
+	if d := calls[1].Sub(calls[0]); d < 10*time.Millisecond {
+		t.Errorf("first backoff = %s; want >= 10ms", d)
+	}
+	if d := calls[2].Sub(calls[1]); d < 15*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("second backoff = %s; want the max backoff 15ms", d)
+	}
+	if len(producer.sent) != 1 || producer.sent[0].Topic != "orders.retry.1" {
+		t.Fatalf("sent = %+v", producer.sent)
+	}
+
+	// The message of the last retry topic is forwarded to the dead letter topic.
+	calls = nil
+	msg = &kafka.ConsumerMessage{Topic: "orders.retry.1", Value: []byte("v")}
+	if err := h.Handle(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(producer.sent) != 2 || producer.sent[1].Topic != "orders.dlq" {
+		t.Fatalf("sent = %+v", producer.sent)
+	}
+
+	// The error of the forward is returned, so the message is not marked.
+	producer.err = errors.New("produce failed")
+	if err := h.Handle(context.Background(), msg); err != producer.err {
+		t.Errorf("Handle = %v; want %v", err, producer.err)
+	}
+
+	// Without the dead letter topic, the error of the handler is returned.
+	h = newRetryHandler("test", config.KafkaRetry{Attempts: 1, DisableDeadLetter: true}, failing, nil)
+	if err := h.Handle(context.Background(), &kafka.ConsumerMessage{Topic: "orders"}); err == nil || err.Error() != "failed" {
+		t.Errorf("Handle = %v; want failed", err)
+	}
+}
+
+func TestNewRetryHandlerVersion(t *testing.T) {
+	kafkaConfig["old"] = config.Kafka{Name: "old"}
+	kafkaConfig["noforward"] = config.Kafka{Name: "noforward", Consumer: config.KafkaConsumer{
+		Retry: config.KafkaRetry{DisableDeadLetter: true},
+	}}
+	defer delete(kafkaConfig, "old")
+	defer delete(kafkaConfig, "noforward")
+
+	if _, err := NewRetryHandler(context.Background(), "old", nil); err != ErrHeadersUnsupported {
+		t.Errorf("NewRetryHandler = %v; want %v", err, ErrHeadersUnsupported)
+	}
+	if _, err := NewRetryHandler(context.Background(), "noforward", nil); err != nil {
+		t.Errorf("NewRetryHandler without forwarding = %v", err)
+	}
+	if err := CheckHeadersSupported("missing"); err != ErrConfigNotFound {
+		t.Errorf("CheckHeadersSupported = %v; want %v", err, ErrConfigNotFound)
+	}
+}
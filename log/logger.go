@@ -65,6 +65,10 @@ var (
 	TypeValRPC = "rpc.log"
 	// TypeValRedis ...
 	TypeValRedis = "redis.log"
+	// TypeValSQL ...
+	TypeValSQL = "sql.log"
+	// TypeValElasticsearch ...
+	TypeValElasticsearch = "elasticsearch.log"
 )
 
 // Init ...
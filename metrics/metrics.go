@@ -39,6 +39,26 @@ func initPrometheus(ctx context.Context, serviceName string, cfg config.Promethe
 		cfg.HTTPClientRequestsDurationSummaryObjectives = skyprome.DefaultObjectives
 	}
 
+	if len(cfg.DBClientRequestsDurationHistogramBuckets) < 1 {
+		cfg.DBClientRequestsDurationHistogramBuckets = skyprome.DefaultBuckets
+	}
+
+	if len(cfg.RedisClientRequestsDurationHistogramBuckets) < 1 {
+		cfg.RedisClientRequestsDurationHistogramBuckets = skyprome.DefaultBuckets
+	}
+
+	if len(cfg.CacheLoadDurationHistogramBuckets) < 1 {
+		cfg.CacheLoadDurationHistogramBuckets = skyprome.DefaultBuckets
+	}
+
+	if len(cfg.ESClientRequestsDurationHistogramBuckets) < 1 {
+		cfg.ESClientRequestsDurationHistogramBuckets = skyprome.DefaultBuckets
+	}
+
+	if len(cfg.ESBulkIndexerFlushDurationHistogramBuckets) < 1 {
+		cfg.ESBulkIndexerFlushDurationHistogramBuckets = skyprome.DefaultBuckets
+	}
+
 	skyprome.SetPromeCfg(cfg)
 	skyprome.SetPromeService(serviceName)
 
@@ -46,6 +66,12 @@ func initPrometheus(ctx context.Context, serviceName string, cfg config.Promethe
 	skyprome.LogInit()
 	skyprome.HttpServerInit()
 	skyprome.HttpClientInit()
+	skyprome.KafkaInit()
+	skyprome.OutboxInit()
+	skyprome.DatabaseInit()
+	skyprome.RedisInit()
+	skyprome.CacheInit()
+	skyprome.ESInit()
 
 	go func() {
 		log.Infof(ctx, "Start HTTP Prometheus metrics. http://%s", cfg.Addr)
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cacheRequestTotalCounter   *prometheus.CounterVec
+	cacheLoadTotalCounter      *prometheus.CounterVec
+	cacheLoadDurationHistogram *prometheus.HistogramVec
+)
+
+func CacheInit() {
+	cacheRequestTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_request_total",
+			Help: "The total number of cache lookups",
+		},
+		[]string{"service", "name", "tier", "result"},
+	)
+
+	cacheLoadTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_load_total",
+			Help: "The total number of cache loads",
+		},
+		[]string{"service", "name", "status"},
+	)
+
+	cacheLoadDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "cache_load_duration_seconds_histogram",
+			Help:    "A histogram of latencies for cache loads.",
+			Buckets: promecfg.CacheLoadDurationHistogramBuckets,
+		},
+		[]string{"service", "name"},
+	)
+}
+
+// CacheRequestTotalCounter ...
+func CacheRequestTotalCounter(name string, tier string, result string) {
+	if promecfg.DisableCacheRequestTotalCounter {
+		return
+	}
+
+	if cacheRequestTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service": service,
+		"name":    name,
+		"tier":    tier,
+		"result":  result,
+	}
+	cacheRequestTotalCounter.With(labels).Inc()
+}
+
+// CacheLoadTotalCounter ...
+func CacheLoadTotalCounter(name string, status string) {
+	if promecfg.DisableCacheLoadTotalCounter {
+		return
+	}
+
+	if cacheLoadTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service": service,
+		"name":    name,
+		"status":  status,
+	}
+	cacheLoadTotalCounter.With(labels).Inc()
+}
+
+// CacheLoadDurationHistogram ...
+func CacheLoadDurationHistogram(name string, duration float64) {
+	if promecfg.DisableCacheLoadDurationHistogram {
+		return
+	}
+
+	if cacheLoadDurationHistogram == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service": service,
+		"name":    name,
+	}
+	cacheLoadDurationHistogram.With(labels).Observe(duration)
+}
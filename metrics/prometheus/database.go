@@ -0,0 +1,202 @@
+package prometheus
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	databaseStatsMu  sync.RWMutex
+	databaseStatsMap = map[string]func() sql.DBStats{}
+
+	dbClientRequestsTotalCounter      *prometheus.CounterVec
+	dbClientRequestsDurationHistogram *prometheus.HistogramVec
+	dbClientTxAttemptTotalCounter     *prometheus.CounterVec
+	dbClientTxDurationHistogram       *prometheus.HistogramVec
+)
+
+// RegisterDatabaseStats registers the stats function of the database instance,
+// which is called by the collector on every scrape.
+func RegisterDatabaseStats(instance string, stats func() sql.DBStats) {
+	databaseStatsMu.Lock()
+	defer databaseStatsMu.Unlock()
+	databaseStatsMap[instance] = stats
+}
+
+func DatabaseInit() {
+	dbClientRequestsTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_client_request_total",
+			Help: "The total number of sql requests",
+		},
+		[]string{"service", "instance", "operation", "statement", "status"},
+	)
+
+	dbClientRequestsDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_client_request_duration_seconds_histogram",
+			Help:    "A histogram of latencies for sql requests.",
+			Buckets: promecfg.DBClientRequestsDurationHistogramBuckets,
+		},
+		[]string{"service", "instance", "operation", "statement"},
+	)
+
+	dbClientTxAttemptTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_client_tx_attempt_total",
+			Help: "The total number of transaction attempts",
+		},
+		[]string{"service", "instance", "status"},
+	)
+
+	dbClientTxDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_client_tx_duration_seconds_histogram",
+			Help:    "A histogram of latencies for transaction attempts.",
+			Buckets: promecfg.DBClientRequestsDurationHistogramBuckets,
+		},
+		[]string{"service", "instance", "status"},
+	)
+
+	if promecfg.DisableDatabasePoolStats {
+		return
+	}
+	prometheus.MustRegister(newDatabaseStatsCollector())
+}
+
+// DBClientRequestsTotalCounter ...
+func DBClientRequestsTotalCounter(instance string, operation string, statement string, status string) {
+	if promecfg.DisableDBClientRequestsTotalCounter {
+		return
+	}
+
+	if dbClientRequestsTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":   service,
+		"instance":  instance,
+		"operation": operation,
+		"statement": statement,
+		"status":    status,
+	}
+	dbClientRequestsTotalCounter.With(labels).Inc()
+}
+
+// DBClientRequestsDurationHistogram ...
+func DBClientRequestsDurationHistogram(instance string, operation string, statement string, duration float64) {
+	if promecfg.DisableDBClientRequestsDurationHistogram {
+		return
+	}
+
+	if dbClientRequestsDurationHistogram == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":   service,
+		"instance":  instance,
+		"operation": operation,
+		"statement": statement,
+	}
+	dbClientRequestsDurationHistogram.With(labels).Observe(duration)
+}
+
+// DBClientTxAttemptTotalCounter ...
+func DBClientTxAttemptTotalCounter(instance string, status string) {
+	if promecfg.DisableDBClientTxAttemptTotalCounter {
+		return
+	}
+
+	if dbClientTxAttemptTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"status":   status,
+	}
+	dbClientTxAttemptTotalCounter.With(labels).Inc()
+}
+
+// DBClientTxDurationHistogram ...
+func DBClientTxDurationHistogram(instance string, status string, duration float64) {
+	if promecfg.DisableDBClientTxDurationHistogram {
+		return
+	}
+
+	if dbClientTxDurationHistogram == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"status":   status,
+	}
+	dbClientTxDurationHistogram.With(labels).Observe(duration)
+}
+
+type databaseStatsCollector struct {
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newDatabaseStatsCollector() *databaseStatsCollector {
+	labels := []string{"service", "instance"}
+	return &databaseStatsCollector{
+		maxOpen:           prometheus.NewDesc("db_client_pool_max_open_connections", "Maximum number of open connections to the database.", labels, nil),
+		open:              prometheus.NewDesc("db_client_pool_open_connections", "The number of established connections both in use and idle.", labels, nil),
+		inUse:             prometheus.NewDesc("db_client_pool_in_use_connections", "The number of connections currently in use.", labels, nil),
+		idle:              prometheus.NewDesc("db_client_pool_idle_connections", "The number of idle connections.", labels, nil),
+		waitCount:         prometheus.NewDesc("db_client_pool_wait_total", "The total number of connections waited for.", labels, nil),
+		waitDuration:      prometheus.NewDesc("db_client_pool_wait_duration_seconds_total", "The total time blocked waiting for a new connection.", labels, nil),
+		maxIdleClosed:     prometheus.NewDesc("db_client_pool_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.", labels, nil),
+		maxIdleTimeClosed: prometheus.NewDesc("db_client_pool_max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime.", labels, nil),
+		maxLifetimeClosed: prometheus.NewDesc("db_client_pool_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.", labels, nil),
+	}
+}
+
+// Describe ...
+func (c *databaseStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+// Collect ...
+func (c *databaseStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	databaseStatsMu.RLock()
+	defer databaseStatsMu.RUnlock()
+
+	for instance, stats := range databaseStatsMap {
+		s := stats()
+		ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed), service, instance)
+	}
+}
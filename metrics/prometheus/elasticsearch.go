@@ -0,0 +1,180 @@
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	esBulkIndexerStatsMu  sync.RWMutex
+	esBulkIndexerStatsMap = map[esBulkIndexerKey]func() esutil.BulkIndexerStats{}
+
+	esClientRequestsTotalCounter        *prometheus.CounterVec
+	esClientRequestsDurationHistogram   *prometheus.HistogramVec
+	esBulkIndexerFlushDurationHistogram *prometheus.HistogramVec
+)
+
+type esBulkIndexerKey struct {
+	instance string
+	indexer  string
+}
+
+// RegisterESBulkIndexerStats registers the stats function of the bulk indexer,
+// which is called by the collector on every scrape. It returns false without
+// registering if the indexer of the same instance and name is registered.
+func RegisterESBulkIndexerStats(instance string, indexer string, stats func() esutil.BulkIndexerStats) bool {
+	esBulkIndexerStatsMu.Lock()
+	defer esBulkIndexerStatsMu.Unlock()
+
+	key := esBulkIndexerKey{instance, indexer}
+	if _, ok := esBulkIndexerStatsMap[key]; ok {
+		return false
+	}
+	esBulkIndexerStatsMap[key] = stats
+	return true
+}
+
+// UnregisterESBulkIndexerStats removes the bulk indexer after it's closed.
+func UnregisterESBulkIndexerStats(instance string, indexer string) {
+	esBulkIndexerStatsMu.Lock()
+	defer esBulkIndexerStatsMu.Unlock()
+	delete(esBulkIndexerStatsMap, esBulkIndexerKey{instance, indexer})
+}
+
+func ESInit() {
+	esClientRequestsTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "es_client_request_total",
+			Help: "The total number of elasticsearch requests",
+		},
+		[]string{"service", "instance", "operation", "code"},
+	)
+
+	esClientRequestsDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "es_client_request_duration_seconds_histogram",
+			Help:    "A histogram of latencies for elasticsearch requests.",
+			Buckets: promecfg.ESClientRequestsDurationHistogramBuckets,
+		},
+		[]string{"service", "instance", "operation"},
+	)
+
+	esBulkIndexerFlushDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "es_bulk_indexer_flush_duration_seconds_histogram",
+			Help:    "A histogram of latencies for elasticsearch bulk indexer flushes.",
+			Buckets: promecfg.ESBulkIndexerFlushDurationHistogramBuckets,
+		},
+		[]string{"service", "instance", "indexer"},
+	)
+
+	if promecfg.DisableESBulkIndexerStats {
+		return
+	}
+	prometheus.MustRegister(newESBulkIndexerStatsCollector())
+}
+
+// ESClientRequestsTotalCounter ...
+func ESClientRequestsTotalCounter(instance string, operation string, code int) {
+	if promecfg.DisableESClientRequestsTotalCounter {
+		return
+	}
+
+	if esClientRequestsTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":   service,
+		"instance":  instance,
+		"operation": operation,
+		"code":      sanitizeCode(code),
+	}
+	esClientRequestsTotalCounter.With(labels).Inc()
+}
+
+// ESClientRequestsDurationHistogram ...
+func ESClientRequestsDurationHistogram(instance string, operation string, duration float64) {
+	if promecfg.DisableESClientRequestsDurationHistogram {
+		return
+	}
+
+	if esClientRequestsDurationHistogram == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":   service,
+		"instance":  instance,
+		"operation": operation,
+	}
+	esClientRequestsDurationHistogram.With(labels).Observe(duration)
+}
+
+// ESBulkIndexerFlushDurationHistogram ...
+func ESBulkIndexerFlushDurationHistogram(instance string, indexer string, duration float64) {
+	if promecfg.DisableESBulkIndexerFlushDurationHistogram {
+		return
+	}
+
+	if esBulkIndexerFlushDurationHistogram == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"indexer":  indexer,
+	}
+	esBulkIndexerFlushDurationHistogram.With(labels).Observe(duration)
+}
+
+type esBulkIndexerStatsCollector struct {
+	queueDepth *prometheus.Desc
+	added      *prometheus.Desc
+	flushed    *prometheus.Desc
+	failed     *prometheus.Desc
+	requests   *prometheus.Desc
+}
+
+func newESBulkIndexerStatsCollector() *esBulkIndexerStatsCollector {
+	labels := []string{"service", "instance", "indexer"}
+	return &esBulkIndexerStatsCollector{
+		queueDepth: prometheus.NewDesc("es_bulk_indexer_queue_depth", "The number of items added but not flushed or failed yet.", labels, nil),
+		added:      prometheus.NewDesc("es_bulk_indexer_items_added_total", "The total number of items added to the bulk indexer.", labels, nil),
+		flushed:    prometheus.NewDesc("es_bulk_indexer_items_flushed_total", "The total number of items flushed successfully.", labels, nil),
+		failed:     prometheus.NewDesc("es_bulk_indexer_items_failed_total", "The total number of items failed.", labels, nil),
+		requests:   prometheus.NewDesc("es_bulk_indexer_requests_total", "The total number of bulk requests.", labels, nil),
+	}
+}
+
+// Describe ...
+func (c *esBulkIndexerStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueDepth
+	ch <- c.added
+	ch <- c.flushed
+	ch <- c.failed
+	ch <- c.requests
+}
+
+// Collect ...
+func (c *esBulkIndexerStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	esBulkIndexerStatsMu.RLock()
+	defer esBulkIndexerStatsMu.RUnlock()
+
+	for key, stats := range esBulkIndexerStatsMap {
+		s := stats()
+		depth := float64(s.NumAdded) - float64(s.NumFlushed) - float64(s.NumFailed)
+		if depth < 0 {
+			depth = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, depth, service, key.instance, key.indexer)
+		ch <- prometheus.MustNewConstMetric(c.added, prometheus.CounterValue, float64(s.NumAdded), service, key.instance, key.indexer)
+		ch <- prometheus.MustNewConstMetric(c.flushed, prometheus.CounterValue, float64(s.NumFlushed), service, key.instance, key.indexer)
+		ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(s.NumFailed), service, key.instance, key.indexer)
+		ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(s.NumRequests), service, key.instance, key.indexer)
+	}
+}
@@ -0,0 +1,66 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	kafkaConsumerRetryTotalCounter      *prometheus.CounterVec
+	kafkaConsumerDeadLetterTotalCounter *prometheus.CounterVec
+)
+
+func KafkaInit() {
+	kafkaConsumerRetryTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_consumer_retry_total",
+			Help: "The total number of retried kafka messages",
+		},
+		[]string{"service", "instance", "topic", "stage"},
+	)
+
+	kafkaConsumerDeadLetterTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_consumer_dead_letter_total",
+			Help: "The total number of dead-lettered kafka messages",
+		},
+		[]string{"service", "instance", "topic"},
+	)
+}
+
+// KafkaConsumerRetryTotalCounter ...
+func KafkaConsumerRetryTotalCounter(instance string, topic string, stage string) {
+	if promecfg.DisableKafkaConsumerRetryTotalCounter {
+		return
+	}
+
+	if kafkaConsumerRetryTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"topic":    topic,
+		"stage":    stage,
+	}
+	kafkaConsumerRetryTotalCounter.With(labels).Inc()
+}
+
+// KafkaConsumerDeadLetterTotalCounter ...
+func KafkaConsumerDeadLetterTotalCounter(instance string, topic string) {
+	if promecfg.DisableKafkaConsumerDeadLetterTotalCounter {
+		return
+	}
+
+	if kafkaConsumerDeadLetterTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"topic":    topic,
+	}
+	kafkaConsumerDeadLetterTotalCounter.With(labels).Inc()
+}
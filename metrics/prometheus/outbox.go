@@ -0,0 +1,77 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	outboxPendingGauge        *prometheus.GaugeVec
+	outboxOldestPendingGauge  *prometheus.GaugeVec
+	outboxPublishTotalCounter *prometheus.CounterVec
+)
+
+func OutboxInit() {
+	outboxPendingGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "outbox_pending_messages",
+			Help: "The number of outbox messages waiting to be published",
+		},
+		[]string{"service", "instance", "table"},
+	)
+
+	outboxOldestPendingGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "outbox_oldest_pending_seconds",
+			Help: "The age of the oldest outbox message waiting to be published",
+		},
+		[]string{"service", "instance", "table"},
+	)
+
+	outboxPublishTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outbox_publish_total",
+			Help: "The total number of published outbox messages",
+		},
+		[]string{"service", "instance", "table", "topic", "status"},
+	)
+}
+
+// OutboxPendingGauge ...
+func OutboxPendingGauge(instance string, table string, pending int64, oldest float64) {
+	if promecfg.DisableOutboxPendingGauge {
+		return
+	}
+
+	if outboxPendingGauge == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"table":    table,
+	}
+	outboxPendingGauge.With(labels).Set(float64(pending))
+	outboxOldestPendingGauge.With(labels).Set(oldest)
+}
+
+// OutboxPublishTotalCounter ...
+func OutboxPublishTotalCounter(instance string, table string, topic string, status string) {
+	if promecfg.DisableOutboxPublishTotalCounter {
+		return
+	}
+
+	if outboxPublishTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"table":    table,
+		"topic":    topic,
+		"status":   status,
+	}
+	outboxPublishTotalCounter.With(labels).Inc()
+}
@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	redisPoolStatsMu  sync.RWMutex
+	redisPoolStatsMap = map[string]func() *redis.PoolStats{}
+
+	redisClientRequestsTotalCounter      *prometheus.CounterVec
+	redisClientRequestsDurationHistogram *prometheus.HistogramVec
+)
+
+// RegisterRedisPoolStats registers the pool stats function of the redis client,
+// which is called by the collector on every scrape.
+func RegisterRedisPoolStats(instance string, stats func() *redis.PoolStats) {
+	redisPoolStatsMu.Lock()
+	defer redisPoolStatsMu.Unlock()
+	redisPoolStatsMap[instance] = stats
+}
+
+func RedisInit() {
+	redisClientRequestsTotalCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_client_request_total",
+			Help: "The total number of redis commands",
+		},
+		[]string{"service", "instance", "command", "status"},
+	)
+
+	redisClientRequestsDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "redis_client_request_duration_seconds_histogram",
+			Help:    "A histogram of latencies for redis commands.",
+			Buckets: promecfg.RedisClientRequestsDurationHistogramBuckets,
+		},
+		[]string{"service", "instance", "command"},
+	)
+
+	if promecfg.DisableRedisPoolStats {
+		return
+	}
+	prometheus.MustRegister(newRedisPoolStatsCollector())
+}
+
+// RedisClientRequestsTotalCounter ...
+func RedisClientRequestsTotalCounter(instance string, command string, status string) {
+	if promecfg.DisableRedisClientRequestsTotalCounter {
+		return
+	}
+
+	if redisClientRequestsTotalCounter == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"command":  command,
+		"status":   status,
+	}
+	redisClientRequestsTotalCounter.With(labels).Inc()
+}
+
+// RedisClientRequestsDurationHistogram ...
+func RedisClientRequestsDurationHistogram(instance string, command string, duration float64) {
+	if promecfg.DisableRedisClientRequestsDurationHistogram {
+		return
+	}
+
+	if redisClientRequestsDurationHistogram == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+		"command":  command,
+	}
+	redisClientRequestsDurationHistogram.With(labels).Observe(duration)
+}
+
+type redisPoolStatsCollector struct {
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+func newRedisPoolStatsCollector() *redisPoolStatsCollector {
+	labels := []string{"service", "instance"}
+	return &redisPoolStatsCollector{
+		hits:       prometheus.NewDesc("redis_client_pool_hits_total", "The total number of times a free connection was found in the pool.", labels, nil),
+		misses:     prometheus.NewDesc("redis_client_pool_misses_total", "The total number of times a free connection was not found in the pool.", labels, nil),
+		timeouts:   prometheus.NewDesc("redis_client_pool_timeouts_total", "The total number of times a wait timeout occurred.", labels, nil),
+		totalConns: prometheus.NewDesc("redis_client_pool_total_connections", "The number of total connections in the pool.", labels, nil),
+		idleConns:  prometheus.NewDesc("redis_client_pool_idle_connections", "The number of idle connections in the pool.", labels, nil),
+		staleConns: prometheus.NewDesc("redis_client_pool_stale_connections_total", "The total number of stale connections removed from the pool.", labels, nil),
+	}
+}
+
+// Describe ...
+func (c *redisPoolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.staleConns
+}
+
+// Collect ...
+func (c *redisPoolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	redisPoolStatsMu.RLock()
+	defer redisPoolStatsMu.RUnlock()
+
+	for instance, stats := range redisPoolStatsMap {
+		s := stats()
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(s.Timeouts), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns), service, instance)
+		ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(s.StaleConns), service, instance)
+	}
+}
@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the idle keys are removed from the memory limiters.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+// memoryTokenBucket is a token bucket per key in the process.
+type memoryTokenBucket struct {
+	mu        sync.Mutex
+	limit     Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewTokenBucket returns an in-memory token bucket limiter. The bucket of
+// every key holds Burst tokens at most, and is refilled by Rate tokens every
+// Period. A request takes a token, or is rejected if there is none.
+func NewTokenBucket(limit Limit) (Limiter, error) {
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &memoryTokenBucket{
+		limit:   limit,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}, nil
+}
+
+// Allow ...
+func (l *memoryTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	interval := l.limit.interval()
+	burst := float64(l.limit.Burst)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, ts: now}
+		l.buckets[key] = b
+	}
+	// The elapsed time is not truncated to milliseconds, otherwise the bucket
+	// would never be refilled by the requests less than a millisecond apart.
+	if elapsed := now.Sub(b.ts); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+milliseconds(elapsed)/interval)
+		b.ts = now
+	}
+
+	l.sweep(now, burst*interval)
+
+	if b.tokens < 1 {
+		wait := math.Ceil((1 - b.tokens) * interval)
+		return Result{RetryAfter: time.Duration(wait) * time.Millisecond}, nil
+	}
+	b.tokens--
+	return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+// sweep removes the buckets which are full again, they are the same as the new ones.
+func (l *memoryTokenBucket) sweep(now time.Time, refill float64) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if milliseconds(now.Sub(b.ts)) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type window struct {
+	index int64
+	prev  int64
+	curr  int64
+}
+
+// memorySlidingWindow is a sliding window counter per key in the process.
+type memorySlidingWindow struct {
+	mu        sync.Mutex
+	limit     Limit
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewSlidingWindow returns an in-memory sliding window limiter, which allows
+// Rate requests in any Period. Burst is ignored.
+func NewSlidingWindow(limit Limit) (Limiter, error) {
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &memorySlidingWindow{
+		limit:   limit,
+		windows: map[string]*window{},
+		now:     time.Now,
+	}, nil
+}
+
+// Allow ...
+func (l *memorySlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UnixNano() / int64(time.Millisecond)
+	size := l.limit.Period.Milliseconds()
+	index := now / size
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{index: index}
+		l.windows[key] = w
+	}
+	switch {
+	case w.index == index-1:
+		w.index, w.prev, w.curr = index, w.curr, 0
+	case w.index < index-1:
+		w.index, w.prev, w.curr = index, 0, 0
+	}
+
+	l.sweep(index)
+
+	res := slidingWindow(l.limit, w.prev, w.curr, now-index*size)
+	if res.Allowed {
+		w.curr++
+	}
+	return res, nil
+}
+
+// sweep removes the windows which have not been used in the last two windows.
+func (l *memorySlidingWindow) sweep(index int64) {
+	now := l.now()
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, w := range l.windows {
+		if w.index < index-1 {
+			delete(l.windows, key)
+		}
+	}
+}
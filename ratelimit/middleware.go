@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+	kitendpoint "github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrLimited ...
+	ErrLimited = errors.New("rate limit exceeded")
+)
+
+// LimitedError is returned by the endpoint middleware if the request is rejected.
+// It's encoded as 429 with the Retry-After header by the go-kit http server.
+type LimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return ErrLimited.Error()
+}
+
+// Unwrap returns ErrLimited.
+func (e *LimitedError) Unwrap() error {
+	return ErrLimited
+}
+
+// StatusCode ...
+func (e *LimitedError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// Headers ...
+func (e *LimitedError) Headers() http.Header {
+	return http.Header{"Retry-After": []string{retryAfter(e.RetryAfter)}}
+}
+
+// retryAfter returns the value of Retry-After in seconds, rounded up.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// KeyFunc returns the key of the http request to limit. The request is not
+// limited if the key is empty.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP limits the requests by the remote address of the connection.
+func KeyByIP() KeyFunc {
+	return func(r *http.Request) string {
+		return remoteIP(r.RemoteAddr)
+	}
+}
+
+// KeyByForwardedIP limits the requests by the client address in X-Forwarded-For
+// or X-Real-IP, or the remote address if they are not set. The headers can be
+// forged by the clients, so use it only behind a proxy which sets them.
+func KeyByForwardedIP() KeyFunc {
+	return func(r *http.Request) string {
+		return forwardedIP(r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Real-IP"), r.RemoteAddr)
+	}
+}
+
+// KeyByHeader limits the requests by the value of the header, e.g. an api key.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+func forwardedIP(forwardedFor string, realIP string, remoteAddr string) string {
+	if forwardedFor != "" {
+		if i := strings.IndexByte(forwardedFor, ','); i >= 0 {
+			forwardedFor = forwardedFor[:i]
+		}
+		if ip := strings.TrimSpace(forwardedFor); ip != "" {
+			return ip
+		}
+	}
+	if realIP != "" {
+		return strings.TrimSpace(realIP)
+	}
+	return remoteIP(remoteAddr)
+}
+
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// Middleware limits the http requests by the key, and responds 429 with Retry-After
+// if it's exceeded. It can be used with http.NewRouter by Router.Use. The requests
+// are allowed if the limiter fails, e.g. redis is down.
+func Middleware(l Limiter, keyFunc KeyFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			res, err := l.Allow(ctx, key)
+			if err != nil {
+				log.Errorw(ctx, "ratelimit allow error", "key", key, "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			if res.Allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Retry-After", retryAfter(res.RetryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": ErrLimited.Error()})
+		})
+	}
+}
+
+// EndpointKeyFunc returns the key of the endpoint request to limit. The request
+// is not limited if the key is empty.
+type EndpointKeyFunc func(ctx context.Context, request interface{}) string
+
+// EndpointKeyByIP limits the requests by the remote address of the connection,
+// which is populated into ctx by the go-kit http server.
+func EndpointKeyByIP() EndpointKeyFunc {
+	return func(ctx context.Context, request interface{}) string {
+		remoteAddr, _ := ctx.Value(kithttp.ContextKeyRequestRemoteAddr).(string)
+		return remoteIP(remoteAddr)
+	}
+}
+
+// EndpointKeyByForwardedIP is KeyByForwardedIP for the endpoint middleware,
+// X-Real-IP is not populated into ctx by the go-kit http server though.
+func EndpointKeyByForwardedIP() EndpointKeyFunc {
+	return func(ctx context.Context, request interface{}) string {
+		forwardedFor, _ := ctx.Value(kithttp.ContextKeyRequestXForwardedFor).(string)
+		remoteAddr, _ := ctx.Value(kithttp.ContextKeyRequestRemoteAddr).(string)
+		return forwardedIP(forwardedFor, "", remoteAddr)
+	}
+}
+
+// EndpointMiddleware limits the endpoint requests by the key, and returns
+// *LimitedError if it's exceeded. The requests are allowed if the limiter fails.
+func EndpointMiddleware(l Limiter, keyFunc EndpointKeyFunc) kitendpoint.Middleware {
+	return func(next kitendpoint.Endpoint) kitendpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key := keyFunc(ctx, request)
+			if key == "" {
+				return next(ctx, request)
+			}
+
+			res, err := l.Allow(ctx, key)
+			if err != nil {
+				log.Errorw(ctx, "ratelimit allow error", "key", key, "err", err)
+				return next(ctx, request)
+			}
+			if !res.Allowed {
+				return nil, &LimitedError{RetryAfter: res.RetryAfter}
+			}
+			return next(ctx, request)
+		}
+	}
+}
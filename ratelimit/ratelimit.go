@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+var (
+	// ErrInvalidLimit ...
+	ErrInvalidLimit = errors.New("rate limit is invalid")
+)
+
+// Result is the decision of a limiter on one request.
+type Result struct {
+	// Allowed reports whether the request is allowed.
+	Allowed bool
+	// Remaining is the number of requests still allowed right now.
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed,
+	// it's 0 if the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter limits the rate of the requests of every key.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Limit allows Rate requests per Period, and up to Burst requests at once
+// for the token bucket. Burst is Rate if it's not set.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// PerSecond ...
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute ...
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+// PerHour ...
+func PerHour(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Hour}
+}
+
+func (l Limit) validate() (Limit, error) {
+	if l.Rate <= 0 || l.Period < time.Millisecond {
+		return l, ErrInvalidLimit
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Rate
+	}
+	return l, nil
+}
+
+// interval returns the time to refill a token in milliseconds.
+func (l Limit) interval() float64 {
+	return float64(l.Period.Milliseconds()) / float64(l.Rate)
+}
+
+// slidingWindow estimates the count of the sliding window from the counts of
+// the previous and the current fixed windows, weighting the previous one by
+// how much it still overlaps the sliding window. elapsed is the milliseconds
+// passed in the current fixed window.
+func slidingWindow(limit Limit, prev int64, curr int64, elapsed int64) Result {
+	window := limit.Period.Milliseconds()
+	count := float64(prev)*float64(window-elapsed)/float64(window) + float64(curr)
+	if count+1 <= float64(limit.Rate) {
+		return Result{
+			Allowed:   true,
+			Remaining: int(float64(limit.Rate) - count - 1),
+		}
+	}
+
+	// Wait until the previous window overlaps little enough. If the current
+	// window is full, it's the previous one of the next window.
+	rate := float64(limit.Rate)
+	var wait int64
+	if curr+1 <= int64(limit.Rate) {
+		wait = int64(math.Ceil(float64(window)*(1-(rate-1-float64(curr))/float64(prev)))) - elapsed
+	} else {
+		wait = window - elapsed + int64(math.Ceil(float64(window)*(1-(rate-1)/float64(curr))))
+	}
+	if wait < 1 {
+		wait = 1
+	}
+	return Result{RetryAfter: time.Duration(wait) * time.Millisecond}
+}
@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) add(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{t: time.Unix(1000, 0)}
+
+	l, err := NewTokenBucket(Limit{Rate: 10, Period: time.Second, Burst: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*memoryTokenBucket).now = c.now
+
+	for i := 0; i < 3; i++ {
+		res, _ := l.Allow(ctx, "a")
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d, got %+v", i, res)
+		}
+	}
+
+	res, _ := l.Allow(ctx, "a")
+	if res.Allowed || res.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("got %+v", res)
+	}
+
+	if res, _ = l.Allow(ctx, "b"); !res.Allowed {
+		t.Fatalf("other key, got %+v", res)
+	}
+
+	c.add(100 * time.Millisecond)
+	if res, _ = l.Allow(ctx, "a"); !res.Allowed {
+		t.Fatalf("after refill, got %+v", res)
+	}
+
+	c.add(time.Hour)
+	if res, _ = l.Allow(ctx, "a"); !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("after an hour, got %+v", res)
+	}
+	if n := len(l.(*memoryTokenBucket).buckets); n != 1 {
+		t.Fatalf("idle buckets are not swept, got %d", n)
+	}
+}
+
+func TestTokenBucketSubMillisecond(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{t: time.Unix(1000, 0)}
+
+	l, err := NewTokenBucket(Limit{Rate: 10, Period: time.Second, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*memoryTokenBucket).now = c.now
+
+	if res, _ := l.Allow(ctx, "a"); !res.Allowed {
+		t.Fatalf("first request, got %+v", res)
+	}
+
+	// A token is refilled every 100ms, by the requests 0.5ms apart.
+	var allowed int
+	for i := 0; i < 400; i++ {
+		c.add(500 * time.Microsecond)
+		if res, _ := l.Allow(ctx, "a"); res.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Fatalf("allowed %d requests in 200ms; want 2", allowed)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{t: time.Unix(1000, 0)}
+
+	l, err := NewSlidingWindow(PerSecond(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*memorySlidingWindow).now = c.now
+
+	for i := 0; i < 4; i++ {
+		if res, _ := l.Allow(ctx, "a"); !res.Allowed || res.Remaining != 3-i {
+			t.Fatalf("request %d, got %+v", i, res)
+		}
+	}
+
+	res, _ := l.Allow(ctx, "a")
+	if res.Allowed || res.RetryAfter != 1250*time.Millisecond {
+		t.Fatalf("got %+v", res)
+	}
+
+	// 3/4 of the previous window still counts.
+	c.add(1250 * time.Millisecond)
+	if res, _ = l.Allow(ctx, "a"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("next window, got %+v", res)
+	}
+	if res, _ = l.Allow(ctx, "a"); res.Allowed || res.RetryAfter != 250*time.Millisecond {
+		t.Fatalf("next window, got %+v", res)
+	}
+
+	c.add(2 * time.Second)
+	if res, _ = l.Allow(ctx, "a"); !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("after two windows, got %+v", res)
+	}
+}
+
+func TestInvalidLimit(t *testing.T) {
+	for _, limit := range []Limit{{}, {Rate: 1}, {Rate: -1, Period: time.Second}} {
+		if _, err := NewTokenBucket(limit); err != ErrInvalidLimit {
+			t.Errorf("%+v, got %v", limit, err)
+		}
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Api-Key", "k1")
+
+	if key := KeyByIP()(r); key != "10.0.0.1" {
+		t.Errorf("KeyByIP, got %q", key)
+	}
+	if key := KeyByForwardedIP()(r); key != "10.0.0.1" {
+		t.Errorf("KeyByForwardedIP without headers, got %q", key)
+	}
+	if key := KeyByHeader("X-Api-Key")(r); key != "k1" {
+		t.Errorf("KeyByHeader, got %q", key)
+	}
+
+	r.Header.Set("X-Real-IP", "192.168.0.2")
+	if key := KeyByForwardedIP()(r); key != "192.168.0.2" {
+		t.Errorf("KeyByForwardedIP with X-Real-IP, got %q", key)
+	}
+	r.Header.Set("X-Forwarded-For", " 192.168.0.1, 10.0.0.1")
+	if key := KeyByForwardedIP()(r); key != "192.168.0.1" {
+		t.Errorf("KeyByForwardedIP with X-Forwarded-For, got %q", key)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, _ := NewTokenBucket(PerMinute(1))
+	h := Middleware(l, KeyByIP())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("second request, got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	l, _ := NewTokenBucket(PerMinute(1))
+	e := EndpointMiddleware(l, EndpointKeyByIP())(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestRemoteAddr, "10.0.0.1:1234")
+	if _, err := e(ctx, nil); err != nil {
+		t.Fatalf("first request, got %v", err)
+	}
+
+	_, err := e(ctx, nil)
+	lerr, ok := err.(*LimitedError)
+	if !ok {
+		t.Fatalf("second request, got %v", err)
+	}
+	if lerr.StatusCode() != http.StatusTooManyRequests || lerr.Headers().Get("Retry-After") != "60" {
+		t.Fatalf("second request, got %d, %v", lerr.StatusCode(), lerr.Headers())
+	}
+}
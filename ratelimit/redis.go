@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	skyredis "github.com/WiFeng/go-sky/redis"
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript refills the bucket by the time passed since it's last
+// updated, and takes a token if there is one. It returns whether the request
+// is allowed, the remaining tokens, and the milliseconds to wait for a token.
+var tokenBucketScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) / interval)
+	ts = now
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * interval)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", ts)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * interval))
+return {allowed, math.floor(tokens), wait}
+`)
+
+// slidingWindowScript returns the counts of the previous and the current
+// windows, and counts the request in the current window if it's allowed.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local curr = tonumber(redis.call("GET", KEYS[1]) or "0")
+local prev = tonumber(redis.call("GET", KEYS[2]) or "0")
+local count = prev * (window - elapsed) / window + curr
+if count + 1 <= limit then
+	redis.call("INCR", KEYS[1])
+	redis.call("PEXPIRE", KEYS[1], window * 2)
+end
+return {prev, curr}
+`)
+
+// redisTokenBucket is a token bucket per key shared by the processes.
+type redisTokenBucket struct {
+	rdb    redis.UniversalClient
+	prefix string
+	limit  Limit
+}
+
+// NewRedisTokenBucket returns a token bucket limiter on the redis instance,
+// shared by all of the processes. The keys are stored as `<prefix>:<key>`.
+// The time of the processes is used, which should be synchronized.
+func NewRedisTokenBucket(ctx context.Context, instance string, prefix string, limit Limit) (Limiter, error) {
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	rdb, err := skyredis.GetUniversalInstance(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisTokenBucket{
+		rdb:    rdb,
+		prefix: prefix,
+		limit:  limit,
+	}, nil
+}
+
+// Allow ...
+func (l *redisTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	vals, err := int64s(tokenBucketScript.Run(ctx, l.rdb, []string{l.prefix + ":" + key},
+		l.limit.Burst, l.limit.interval(), now), 3)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    vals[0] == 1,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+	}, nil
+}
+
+// redisSlidingWindow is a sliding window counter per key shared by the processes.
+type redisSlidingWindow struct {
+	rdb    redis.UniversalClient
+	prefix string
+	limit  Limit
+}
+
+// NewRedisSlidingWindow returns a sliding window limiter on the redis instance,
+// shared by all of the processes. The keys are stored as `{<prefix>:<key>}:<window>`,
+// so that the windows of a key are in the same slot of a cluster.
+// The time of the processes is used, which should be synchronized.
+func NewRedisSlidingWindow(ctx context.Context, instance string, prefix string, limit Limit) (Limiter, error) {
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	rdb, err := skyredis.GetUniversalInstance(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisSlidingWindow{
+		rdb:    rdb,
+		prefix: prefix,
+		limit:  limit,
+	}, nil
+}
+
+// Allow ...
+func (l *redisSlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	size := l.limit.Period.Milliseconds()
+	index := now / size
+	elapsed := now - index*size
+
+	base := "{" + l.prefix + ":" + key + "}:"
+	keys := []string{base + strconv.FormatInt(index, 10), base + strconv.FormatInt(index-1, 10)}
+	vals, err := int64s(slidingWindowScript.Run(ctx, l.rdb, keys, l.limit.Rate, size, elapsed), 2)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return slidingWindow(l.limit, vals[0], vals[1], elapsed), nil
+}
+
+// int64s returns the n integers replied by a script.
+func int64s(cmd *redis.Cmd, n int) ([]int64, error) {
+	v, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := v.([]interface{})
+	if !ok || len(items) != n {
+		return nil, fmt.Errorf("ratelimit: unexpected script reply %v", v)
+	}
+
+	vals := make([]int64, n)
+	for i, item := range items {
+		if vals[i], ok = item.(int64); !ok {
+			return nil, fmt.Errorf("ratelimit: unexpected script reply %v", v)
+		}
+	}
+	return vals, nil
+}
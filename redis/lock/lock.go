@@ -0,0 +1,278 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/WiFeng/go-sky/log"
+	skyredis "github.com/WiFeng/go-sky/redis"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrNotAcquired ...
+	ErrNotAcquired = errors.New("redis lock is not acquired")
+	// ErrNotHeld ...
+	ErrNotHeld = errors.New("redis lock is not held")
+	// ErrInvalidTTL ...
+	ErrInvalidTTL = errors.New("redis lock ttl is invalid")
+)
+
+// releaseScript deletes the key only if it's still held by the token.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// renewScript extends the ttl of the key only if it's still held by the token.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Option ...
+type Option func(*options)
+
+type options struct {
+	retryInterval time.Duration
+	noRenewal     bool
+}
+
+// WithRetryInterval sets the wait time between two attempts of Acquire, 100ms by default.
+func WithRetryInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.retryInterval = d
+	}
+}
+
+// WithoutRenewal makes the lock expire after ttl, even if it's not released.
+func WithoutRenewal() Option {
+	return func(o *options) {
+		o.noRenewal = true
+	}
+}
+
+// Lock is a lock held on one redis instance, or on the majority of several
+// instances with the Redlock algorithm. The lease is renewed every ttl/3
+// until Release is called, and Lost is closed if it can not be renewed.
+type Lock struct {
+	key     string
+	token   string
+	ttl     time.Duration
+	quorum  int
+	clients []redis.UniversalClient
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lost   chan struct{}
+
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+// Acquire acquires the lock `key` on the redis instance, waiting until it's
+// released by the holder or ctx is done.
+func Acquire(ctx context.Context, instance string, key string, ttl time.Duration, opt ...Option) (*Lock, error) {
+	return AcquireRedlock(ctx, []string{instance}, key, ttl, opt...)
+}
+
+// TryAcquire is Acquire without waiting, ErrNotAcquired is returned if the lock is held by others.
+func TryAcquire(ctx context.Context, instance string, key string, ttl time.Duration, opt ...Option) (*Lock, error) {
+	return TryAcquireRedlock(ctx, []string{instance}, key, ttl, opt...)
+}
+
+// AcquireRedlock acquires the lock `key` on the majority of the independent redis
+// instances with the Redlock algorithm, waiting until it's acquired or ctx is done.
+func AcquireRedlock(ctx context.Context, instances []string, key string, ttl time.Duration, opt ...Option) (*Lock, error) {
+	o := newOptions(opt...)
+	for {
+		l, err := tryAcquire(ctx, instances, key, ttl, o)
+		if err != ErrNotAcquired {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(o.retryInterval):
+		}
+	}
+}
+
+// TryAcquireRedlock is AcquireRedlock without waiting.
+func TryAcquireRedlock(ctx context.Context, instances []string, key string, ttl time.Duration, opt ...Option) (*Lock, error) {
+	return tryAcquire(ctx, instances, key, ttl, newOptions(opt...))
+}
+
+func newOptions(opt ...Option) options {
+	o := options{
+		retryInterval: 100 * time.Millisecond,
+	}
+	for _, f := range opt {
+		f(&o)
+	}
+	return o
+}
+
+func tryAcquire(ctx context.Context, instances []string, key string, ttl time.Duration, o options) (*Lock, error) {
+	if ttl < time.Millisecond {
+		return nil, ErrInvalidTTL
+	}
+
+	var clients []redis.UniversalClient
+	for _, instance := range instances {
+		rdb, err := skyredis.GetUniversalInstance(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, rdb)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lock{
+		key:     key,
+		token:   token,
+		ttl:     ttl,
+		quorum:  len(clients)/2 + 1,
+		clients: clients,
+		done:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+
+	begin := time.Now()
+	var acquired int
+	var lastErr error
+	for _, rdb := range clients {
+		ok, err := rdb.SetNX(ctx, key, token, ttl).Result()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			acquired++
+		}
+	}
+
+	// The lock is valid only if it's acquired on the majority of the
+	// instances before the ttl expires, minus the clock drift.
+	drift := ttl/100 + 2*time.Millisecond
+	if acquired < l.quorum || time.Since(begin)+drift >= ttl {
+		l.release(context.Background())
+		if acquired == 0 && lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrNotAcquired
+	}
+
+	if o.noRenewal {
+		close(l.done)
+		return l, nil
+	}
+
+	rctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.renew(rctx)
+
+	return l, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Key ...
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the random value identifying the holder of the lock.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost is closed if the lease can not be renewed, then the lock may be held by others.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) renew(ctx context.Context) {
+	defer close(l.done)
+
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ttl := l.ttl.Milliseconds()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var renewed int
+		for _, rdb := range l.clients {
+			cctx, cancel := context.WithTimeout(ctx, interval)
+			n, err := renewScript.Run(cctx, rdb, []string{l.key}, l.token, ttl).Int()
+			cancel()
+			if err == nil && n == 1 {
+				renewed++
+			}
+		}
+
+		if renewed < l.quorum {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warnw(ctx, "redis lock lost", "key", l.key, "renewed", renewed, "quorum", l.quorum)
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// Release stops the renewal and releases the lock, if it's still held by the token.
+// ErrNotHeld is returned if it's expired or held by others.
+func (l *Lock) Release(ctx context.Context) error {
+	l.releaseOnce.Do(func() {
+		if l.cancel != nil {
+			l.cancel()
+		}
+		<-l.done
+
+		if l.release(ctx) < l.quorum {
+			l.releaseErr = ErrNotHeld
+		}
+	})
+	return l.releaseErr
+}
+
+// release deletes the key on all of the instances, and returns how many are released.
+func (l *Lock) release(ctx context.Context) int {
+	var released int
+	for _, rdb := range l.clients {
+		n, err := releaseScript.Run(ctx, rdb, []string{l.key}, l.token).Int()
+		if err != nil {
+			log.Warnw(ctx, "redis lock release error", "key", l.key, "err", err)
+			continue
+		}
+		released += n
+	}
+	return released
+}
@@ -0,0 +1,168 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/log"
+	skyredis "github.com/WiFeng/go-sky/redis"
+	"github.com/alicebob/miniredis/v2"
+)
+
+var (
+	testName    = "redis"
+	testService = "testService"
+
+	// testRedis is the miniredis server of testName. Its keys expire only
+	// by FastForward, which the tests use to pass the ttl without waiting.
+	testRedis *miniredis.Miniredis
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	if testRedis, err = miniredis.Run(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	port, _ := strconv.Atoi(testRedis.Port())
+	redisConf := []config.Redis{
+		{
+			Name: testName,
+			Host: testRedis.Host(),
+			Port: port,
+			Auth: "",
+			DB:   0,
+		},
+	}
+
+	logConf := config.Log{
+		Level: "info",
+	}
+	if _, err := log.Init(context.Background(), testService, logConf); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	skyredis.Init(context.Background(), testService, redisConf)
+
+	code := m.Run()
+	testRedis.Close()
+	os.Exit(code)
+}
+
+// waitRenewed waits until the ttl of the key is renewed above d.
+func waitRenewed(t *testing.T, key string, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for testRedis.TTL(key) <= d {
+		if time.Now().After(deadline) {
+			t.Fatalf("ttl of %s = %v; want renewed above %v", key, testRedis.TTL(key), d)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	var ctx = context.Background()
+	var key = "__gotest__:lock:key1"
+	var ttl = 300 * time.Millisecond
+
+	l, err := Acquire(ctx, testName, key, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = TryAcquire(ctx, testName, key, ttl); err != ErrNotAcquired {
+		t.Errorf("TryAcquire = %v; want %v", err, ErrNotAcquired)
+	}
+
+	// The lease is renewed beyond the ttl.
+	for i := 0; i < 3; i++ {
+		testRedis.FastForward(ttl * 2 / 3)
+		waitRenewed(t, key, ttl/2)
+	}
+	select {
+	case <-l.Lost():
+		t.Error("lock is lost")
+	default:
+	}
+	if _, err = TryAcquire(ctx, testName, key, ttl); err != ErrNotAcquired {
+		t.Errorf("TryAcquire after ttl = %v; want %v", err, ErrNotAcquired)
+	}
+
+	if err = l.Release(ctx); err != nil {
+		t.Errorf("Release = %v; want nil", err)
+	}
+	if testRedis.Exists(key) {
+		t.Error("key exists after Release")
+	}
+
+	l2, err := TryAcquire(ctx, testName, key, ttl, WithoutRenewal())
+	if err != nil {
+		t.Fatalf("TryAcquire after release = %v; want nil", err)
+	}
+	testRedis.FastForward(ttl)
+	if err = l2.Release(ctx); err != ErrNotHeld {
+		t.Errorf("Release expired = %v; want %v", err, ErrNotHeld)
+	}
+}
+
+func TestLost(t *testing.T) {
+	var ctx = context.Background()
+	var key = "__gotest__:lock:key4"
+	var ttl = 300 * time.Millisecond
+
+	l, err := Acquire(ctx, testName, key, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lease expires before it's renewed.
+	testRedis.FastForward(ttl)
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock is not lost")
+	}
+	if err = l.Release(ctx); err != ErrNotHeld {
+		t.Errorf("Release lost = %v; want %v", err, ErrNotHeld)
+	}
+}
+
+func TestAcquireContextCancel(t *testing.T) {
+	var key = "__gotest__:lock:key2"
+
+	l, err := Acquire(context.Background(), testName, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err = Acquire(ctx, testName, key, time.Second); err != context.DeadlineExceeded {
+		t.Errorf("Acquire = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestAcquireRedlock(t *testing.T) {
+	var ctx = context.Background()
+	var key = "__gotest__:lock:key3"
+
+	l, err := AcquireRedlock(ctx, []string{testName}, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Release(ctx); err != nil {
+		t.Errorf("Release = %v; want nil", err)
+	}
+
+	if _, err = AcquireRedlock(ctx, []string{testName, "not_found"}, key, time.Second); err != skyredis.ErrConfigNotFound {
+		t.Errorf("AcquireRedlock = %v; want %v", err, skyredis.ErrConfigNotFound)
+	}
+}
@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/WiFeng/go-sky/helper"
+	"github.com/WiFeng/go-sky/log"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+// SubscriberHandler handles the messages received by RunSubscriber. The messages
+// are at most once, they are lost if the handler fails or the subscriber is down.
+type SubscriberHandler interface {
+	Handle(ctx context.Context, msg *redis.Message) error
+}
+
+// SubscriberHandlerFunc ...
+type SubscriberHandlerFunc func(ctx context.Context, msg *redis.Message) error
+
+// Handle ...
+func (f SubscriberHandlerFunc) Handle(ctx context.Context, msg *redis.Message) error {
+	return f(ctx, msg)
+}
+
+// RunSubscriber subscribes the channels on the redis instance `name`, and handles
+// the messages until ctx is done, SIGINT/SIGTERM is received or the process runs
+// its defer functions. The channels containing `*`, `?` or `[` are subscribed as patterns.
+// It resubscribes the channels after reconnecting.
+func RunSubscriber(ctx context.Context, name string, channels []string, handler SubscriberHandler) error {
+	rdb, err := GetUniversalInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var plain, patterns []string
+	for _, channel := range channels {
+		if isPattern(channel) {
+			patterns = append(patterns, channel)
+		} else {
+			plain = append(plain, channel)
+		}
+	}
+
+	ctx, stop := helper.RunUntilShutdown(ctx, func(sig os.Signal) {
+		log.Infow(ctx, "redis subscriber prepare shutdown", "name", name, "channels", channels, "signal", sig.String())
+	})
+	defer stop()
+
+	ps := rdb.Subscribe(ctx)
+	defer ps.Close()
+
+	if len(plain) > 0 {
+		if err = ps.Subscribe(ctx, plain...); err != nil {
+			log.Errorw(ctx, "redis subscribe error", "name", name, "channels", plain, "err", err)
+			return err
+		}
+	}
+	if len(patterns) > 0 {
+		if err = ps.PSubscribe(ctx, patterns...); err != nil {
+			log.Errorw(ctx, "redis psubscribe error", "name", name, "patterns", patterns, "err", err)
+			return err
+		}
+	}
+
+	log.Infow(ctx, "redis subscriber start", "name", name, "channels", channels)
+	ch := ps.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infow(context.Background(), "redis subscriber exit", "name", name, "channels", channels)
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				log.Infow(context.Background(), "redis subscriber exit", "name", name, "channels", channels)
+				return nil
+			}
+			handleSubscriberMessage(name, handler, msg)
+		}
+	}
+}
+
+func isPattern(channel string) bool {
+	for _, c := range channel {
+		switch c {
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+func handleSubscriberMessage(name string, handler SubscriberHandler, msg *redis.Message) (err error) {
+	var ctx = context.Background()
+	var span = opentracing.GlobalTracer().StartSpan(
+		"redis.Subscriber.Handle",
+		opentracing.Tag{Key: "message.channel", Value: msg.Channel},
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "redis"},
+		opentracingext.SpanKindConsumer,
+	)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = log.BuildLogger(ctx)
+
+	defer func(begin time.Time) {
+		if panicErr := recover(); panicErr != nil {
+			log.Errorw(ctx, "redis subscriber handler panic error", "err", panicErr)
+			err = ErrHandlerPanic
+		}
+
+		if err != nil {
+			opentracingext.Error.Set(span, true)
+			span.SetTag("message.error", err.Error())
+			log.Errorw(ctx, "redis subscriber handler error", "name", name, "channel", msg.Channel, "err", err)
+		}
+
+		log.Debugw(ctx, fmt.Sprintf("consume %s", msg.Channel), "name", name,
+			"request_time", fmt.Sprintf("%.3f", float32(time.Since(begin).Microseconds())/1000))
+		span.Finish()
+	}(time.Now())
+
+	err = handler.Handle(ctx, msg)
+	return
+}
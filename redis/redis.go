@@ -2,61 +2,181 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/WiFeng/go-sky/config"
 	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	// ModeStandalone ...
+	ModeStandalone = "standalone"
+	// ModeSentinel ...
+	ModeSentinel = "sentinel"
+	// ModeCluster ...
+	ModeCluster = "cluster"
+)
+
 var (
-	redisMap    = map[string]*redis.Client{}
-	redisConfig = map[string]config.Redis{}
+	redisMap          = map[string]*redis.Client{}
+	redisUniversalMap = map[string]redis.UniversalClient{}
+	redisConfig       = map[string]config.Redis{}
 )
 
 var (
 	// ErrConfigNotFound ...
 	ErrConfigNotFound = errors.New("redis config is not found")
+	// ErrClusterMode ...
+	ErrClusterMode = errors.New("redis instance is in cluster mode, use GetUniversalInstance")
+	// ErrUnknownMode ...
+	ErrUnknownMode = errors.New("redis mode is unknown")
+	// ErrMasterNameNotFound ...
+	ErrMasterNameNotFound = errors.New("redis sentinel master name is not found")
+	// ErrInvalidCAFile ...
+	ErrInvalidCAFile = errors.New("redis tls ca file has no certificate")
 )
 
 // Init ...
 func Init(ctx context.Context, serviceName string, cfs []config.Redis) {
 	for _, cf := range cfs {
+		if cf.Mode == "" {
+			cf.Mode = ModeStandalone
+		}
 		redisConfig[cf.Name] = cf
 
-		var rdb *redis.Client
-		{
-			addr := fmt.Sprintf("%s:%d", cf.Host, cf.Port)
-			pass := cf.Auth
-			db := cf.DB
-			rdb = redis.NewClient(&redis.Options{
-				Addr:     addr,
-				Password: pass,
-				DB:       db,
-			})
+		rdb, err := newClient(cf)
+		if err != nil {
+			log.Fatalw(ctx, "redis new client error", "name", cf.Name, "mode", cf.Mode, "err", err)
+			continue
+		}
+
+		if _, err = rdb.Ping(ctx).Result(); err != nil {
+			log.Fatalw(ctx, "redis ping error", "name", cf.Name, "mode", cf.Mode, "addrs", addrs(cf), "err", err)
+			continue
+		}
+
+		rdb.AddHook(newTracingHook(cf, strings.Join(addrs(cf), ",")))
+		rdb.AddHook(loggingHook{name: cf.Name, slowThreshold: cf.SlowThresholdMillSec * time.Millisecond})
+		rdb.AddHook(metricsHook{name: cf.Name})
+		skyprome.RegisterRedisPoolStats(cf.Name, rdb.PoolStats)
+
+		// Dont show passwd in log
+		logCf := cf
+		logCf.Auth = "dont show me!"
+		logCf.SentinelPassword = "dont show me!"
+		log.Infof(ctx, "Init redis [%s] %+v", cf.Name, logCf)
+
+		redisUniversalMap[cf.Name] = rdb
+		if client, ok := rdb.(*redis.Client); ok {
+			redisMap[cf.Name] = client
+		}
+	}
+}
+
+func addrs(cf config.Redis) []string {
+	if len(cf.Addrs) > 0 {
+		return cf.Addrs
+	}
+	return []string{fmt.Sprintf("%s:%d", cf.Host, cf.Port)}
+}
+
+func newClient(cf config.Redis) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            addrs(cf),
+		DB:               cf.DB,
+		Username:         cf.Username,
+		Password:         cf.Auth,
+		SentinelPassword: cf.SentinelPassword,
+		MasterName:       cf.MasterName,
+		MaxRetries:       cf.MaxRetries,
+		DialTimeout:      cf.DialTimeoutMillSec * time.Millisecond,
+		ReadTimeout:      cf.ReadTimeoutMillSec * time.Millisecond,
+		WriteTimeout:     cf.WriteTimeoutMillSec * time.Millisecond,
+		PoolSize:         cf.PoolSize,
+		MinIdleConns:     cf.MinIdleConns,
+	}
+
+	if cf.TLS {
+		tlsConfig, err := newTLSConfig(cf)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	switch cf.Mode {
+	case ModeStandalone:
+		return redis.NewClient(opts.Simple()), nil
+	case ModeSentinel:
+		if cf.MasterName == "" {
+			return nil, ErrMasterNameNotFound
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case ModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	}
+	return nil, ErrUnknownMode
+}
+
+func newTLSConfig(cf config.Redis) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cf.TLSServerName,
+		InsecureSkipVerify: cf.TLSSkipVerify,
+	}
 
-			if _, err := rdb.Ping(ctx).Result(); err != nil {
-				log.Fatalw(ctx, "redis ping error", "conf", cf, "err", err)
-				continue
-			}
+	if cf.TLSCAFile != "" {
+		ca, err := ioutil.ReadFile(cf.TLSCAFile)
+		if err != nil {
+			return nil, err
 		}
 
-		rdb.AddHook(tracingHook{})
-		rdb.AddHook(loggingHook{})
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, ErrInvalidCAFile
+		}
+		tlsConfig.RootCAs = pool
+	}
 
-		log.Infof(ctx, "Init redis [%s] %+v", cf.Name, cf)
-		redisMap[cf.Name] = rdb
+	if cf.TLSCertFile != "" || cf.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cf.TLSCertFile, cf.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
+
+	return tlsConfig, nil
 }
 
-// GetInstance ...
+// GetInstance returns the client of a standalone or sentinel redis instance.
 func GetInstance(ctx context.Context, redisName string) (*redis.Client, error) {
 	rdb, ok := redisMap[redisName]
 	if !ok {
 		err := ErrConfigNotFound
+		if cf, ok := redisConfig[redisName]; ok && cf.Mode == ModeCluster {
+			err = ErrClusterMode
+		}
 		log.Errorw(ctx, "redis.GetInstance, redisName is not in redisMap map", "redis_name", redisName, "err", err)
 		return nil, err
 	}
 	return rdb, nil
 }
+
+// GetUniversalInstance returns the client of a redis instance in any mode.
+func GetUniversalInstance(ctx context.Context, redisName string) (redis.UniversalClient, error) {
+	rdb, ok := redisUniversalMap[redisName]
+	if !ok {
+		err := ErrConfigNotFound
+		log.Errorw(ctx, "redis.GetUniversalInstance, redisName is not in redisUniversalMap map", "redis_name", redisName, "err", err)
+		return nil, err
+	}
+	return rdb, nil
+}
@@ -3,38 +3,228 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/log"
+	skyprome "github.com/WiFeng/go-sky/metrics/prometheus"
 	"github.com/go-redis/redis/v8"
 	"github.com/opentracing/opentracing-go"
 	opentracingext "github.com/opentracing/opentracing-go/ext"
 )
 
-// loggingHook ...
+type hookContextKey int
+
+const (
+	loggingBeginContext hookContextKey = iota
+	metricsBeginContext
+)
+
+// loggingHook logs every command and pipeline to redis.log, the commands
+// slower than slowThreshold are logged as warnings. The arguments of a command,
+// which may be large values, are logged only if it fails or it's slow.
 type loggingHook struct {
+	name          string
+	slowThreshold time.Duration
 }
 
 // BeforeProcess ....
 func (r loggingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
-	return ctx, nil
+	return context.WithValue(ctx, loggingBeginContext, time.Now()), nil
 }
 
 // AfterProcess ...
 func (r loggingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	begin, ok := ctx.Value(loggingBeginContext).(time.Time)
+	if !ok {
+		return nil
+	}
+
+	elapsed := time.Since(begin)
+	err := cmdErr(cmd)
+
+	keysAndValues := []interface{}{"key", cmdKey(cmd)}
+	if err != nil || r.isSlow(elapsed) {
+		keysAndValues = append(keysAndValues, "args", cmdArgs(cmd, maxLogArgsLen))
+	}
+
+	r.log(ctx, cmd.Name(), elapsed, err, keysAndValues...)
 	return nil
 }
 
 // BeforeProcessPipeline ...
 func (r loggingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
-	return ctx, nil
+	return context.WithValue(ctx, loggingBeginContext, time.Now()), nil
 }
 
 // AfterProcessPipeline ...
 func (r loggingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	begin, ok := ctx.Value(loggingBeginContext).(time.Time)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	var err error
+	for _, cmd := range cmds {
+		names = append(names, cmd.Name())
+		if err == nil {
+			err = cmdErr(cmd)
+		}
+	}
+
+	r.log(ctx, "pipeline", time.Since(begin), err, "count", len(cmds), "cmds", strings.Join(names, " "))
+	return nil
+}
+
+func (r loggingHook) log(ctx context.Context, name string, elapsed time.Duration, err error, keysAndValues ...interface{}) {
+	keysAndValues = append([]interface{}{log.TypeKey, log.TypeValRedis, "instance", r.name}, keysAndValues...)
+	keysAndValues = append(keysAndValues, "request_time", fmt.Sprintf("%.3f", float32(elapsed.Microseconds())/1000), "err", err)
+
+	switch {
+	case err != nil:
+		log.Errorw(ctx, name, keysAndValues...)
+	case r.isSlow(elapsed):
+		log.Warnw(ctx, "slow "+name, keysAndValues...)
+	default:
+		log.Infow(ctx, name, keysAndValues...)
+	}
+}
+
+func (r loggingHook) isSlow(elapsed time.Duration) bool {
+	return r.slowThreshold > 0 && elapsed >= r.slowThreshold
+}
+
+// metricsHook records the redis_client_* metrics of every command and pipeline.
+type metricsHook struct {
+	name string
+}
+
+// BeforeProcess ...
+func (r metricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsBeginContext, time.Now()), nil
+}
+
+// AfterProcess ...
+func (r metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	begin, ok := ctx.Value(metricsBeginContext).(time.Time)
+	if !ok {
+		return nil
+	}
+
+	r.observe(cmd.Name(), cmdStatus(cmd.Err()), time.Since(begin))
 	return nil
 }
 
+// BeforeProcessPipeline ...
+func (r metricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, metricsBeginContext, time.Now()), nil
+}
+
+// AfterProcessPipeline ...
+func (r metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	begin, ok := ctx.Value(metricsBeginContext).(time.Time)
+	if !ok {
+		return nil
+	}
+
+	status := "ok"
+	for _, cmd := range cmds {
+		if s := cmdStatus(cmd.Err()); s == "error" {
+			status = s
+			break
+		}
+	}
+
+	r.observe("pipeline", status, time.Since(begin))
+	return nil
+}
+
+func (r metricsHook) observe(command string, status string, elapsed time.Duration) {
+	skyprome.RedisClientRequestsTotalCounter(r.name, command, status)
+	skyprome.RedisClientRequestsDurationHistogram(r.name, command, elapsed.Seconds())
+}
+
+const (
+	maxLogArgsLen = 256
+)
+
+// cmdErr returns the error of cmd, a missing key is not an error.
+func cmdErr(cmd redis.Cmder) error {
+	if err := cmd.Err(); err != redis.Nil {
+		return err
+	}
+	return nil
+}
+
+func cmdStatus(err error) string {
+	switch err {
+	case nil:
+		return "ok"
+	case redis.Nil:
+		return "miss"
+	}
+	return "error"
+}
+
+// cmdKey returns the first argument after the command name, which is the key of most commands.
+func cmdKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	return fmt.Sprint(args[1])
+}
+
+// cmdArgs returns the arguments of cmd joined by spaces, truncated to maxLen bytes.
+func cmdArgs(cmd redis.Cmder, maxLen int) string {
+	var b strings.Builder
+	for i, arg := range cmd.Args() {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprint(&b, arg)
+		if maxLen > 0 && b.Len() > maxLen {
+			return b.String()[:maxLen] + "..."
+		}
+	}
+	return b.String()
+}
+
 // tracingHook ...
 type tracingHook struct {
+	name            string
+	addr            string
+	maxArgsLen      int
+	maxPipelineCmds int
+}
+
+func newTracingHook(cf config.Redis, addr string) tracingHook {
+	h := tracingHook{
+		name:            cf.Name,
+		addr:            addr,
+		maxArgsLen:      cf.TraceMaxArgsLen,
+		maxPipelineCmds: cf.TraceMaxPipelineCmds,
+	}
+	if h.maxArgsLen == 0 {
+		h.maxArgsLen = 256
+	}
+	if h.maxPipelineCmds == 0 {
+		h.maxPipelineCmds = 100
+	}
+	return h
+}
+
+func (r tracingHook) startSpanOptions(parentSpan opentracing.Span) []opentracing.StartSpanOption {
+	return []opentracing.StartSpanOption{
+		opentracing.ChildOf(parentSpan.Context()),
+		opentracing.Tag{Key: string(opentracingext.DBType), Value: "redis"},
+		opentracing.Tag{Key: string(opentracingext.DBInstance), Value: r.name},
+		opentracing.Tag{Key: string(opentracingext.PeerAddress), Value: r.addr},
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "redis"},
+		opentracingext.SpanKindRPCClient,
+	}
 }
 
 // BeforeProcess ...
@@ -44,15 +234,16 @@ func (r tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (contex
 	var childSpan opentracing.Span
 
 	if parentSpan = opentracing.SpanFromContext(ctx); parentSpan != nil {
+		opts := r.startSpanOptions(parentSpan)
+		opts = append(opts, opentracing.Tag{Key: "cmd.name", Value: cmd.Name()})
+		// A negative maxArgsLen disables the arguments tag.
+		if r.maxArgsLen > 0 {
+			opts = append(opts, opentracing.Tag{Key: "cmd.string", Value: cmdArgs(cmd, r.maxArgsLen)})
+		}
+
 		childSpan = parentSpan.Tracer().StartSpan(
 			fmt.Sprintf("redis.%s", cmd.Name()),
-			opentracing.ChildOf(parentSpan.Context()),
-
-			opentracing.Tag{Key: "cmd.name", Value: cmd.Name()},
-			// opentracing.Tag{Key: "cmd.fullname", Value: cmd.FullName()},
-			opentracing.Tag{Key: "cmd.string", Value: cmd.String()},
-			opentracing.Tag{Key: string(opentracingext.Component), Value: "redis"},
-			opentracingext.SpanKindRPCClient,
+			opts...,
 		)
 		ctx = opentracing.ContextWithSpan(ctx, childSpan)
 	}
@@ -63,6 +254,14 @@ func (r tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (contex
 // AfterProcess ...
 func (r tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
 	if childSpan := opentracing.SpanFromContext(ctx); childSpan != nil {
+		switch err := cmd.Err(); err {
+		case nil:
+		case redis.Nil:
+			childSpan.SetTag("redis.miss", true)
+		default:
+			opentracingext.Error.Set(childSpan, true)
+			childSpan.SetTag("redis.error", err.Error())
+		}
 		childSpan.Finish()
 	}
 
@@ -75,18 +274,17 @@ func (r tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmd
 	var childSpan opentracing.Span
 
 	if parentSpan = opentracing.SpanFromContext(ctx); parentSpan != nil {
-		var opts []opentracing.StartSpanOption
-		opts = append(opts, opentracing.ChildOf(parentSpan.Context()),
-			opentracing.Tag{Key: string(opentracingext.Component), Value: "redis"},
-			opentracingext.SpanKindRPCClient)
+		opts := r.startSpanOptions(parentSpan)
 
 		_cmds := cmds
-		if len(cmds) > 100 {
-			_cmds = cmds[:100]
+		if r.maxPipelineCmds >= 0 && len(cmds) > r.maxPipelineCmds {
+			_cmds = cmds[:r.maxPipelineCmds]
 		}
 		for i, cmd := range _cmds {
 			opts = append(opts, opentracing.Tag{Key: fmt.Sprintf("cmd.%d.name", i), Value: cmd.Name()})
-			opts = append(opts, opentracing.Tag{Key: fmt.Sprintf("cmd.%d.string", i), Value: cmd.String()})
+			if r.maxArgsLen > 0 {
+				opts = append(opts, opentracing.Tag{Key: fmt.Sprintf("cmd.%d.string", i), Value: cmdArgs(cmd, r.maxArgsLen)})
+			}
 		}
 		opts = append(opts, opentracing.Tag{Key: "cmd.length", Value: len(cmds)})
 
@@ -103,6 +301,27 @@ func (r tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmd
 // AfterProcessPipeline ...
 func (r tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
 	if childSpan := opentracing.SpanFromContext(ctx); childSpan != nil {
+		var misses int
+		var errs int
+		for i, cmd := range cmds {
+			switch err := cmd.Err(); err {
+			case nil:
+			case redis.Nil:
+				misses++
+			default:
+				if errs == 0 {
+					opentracingext.Error.Set(childSpan, true)
+					childSpan.SetTag("redis.error", fmt.Sprintf("cmd.%d: %v", i, err))
+				}
+				errs++
+			}
+		}
+		if misses > 0 {
+			childSpan.SetTag("redis.misses", misses)
+		}
+		if errs > 0 {
+			childSpan.SetTag("redis.errors", errs)
+		}
 		childSpan.Finish()
 	}
 	return nil
@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WiFeng/go-sky/config"
+	"github.com/WiFeng/go-sky/log"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestCmdHelpers(t *testing.T) {
+	var ctx = context.Background()
+
+	cmd := redis.NewStringCmd(ctx, "get", "__gotest__:key1")
+	if got := cmdKey(cmd); got != "__gotest__:key1" {
+		t.Errorf("cmdKey = %s; want __gotest__:key1", got)
+	}
+	if got := cmdArgs(cmd, 0); got != "get __gotest__:key1" {
+		t.Errorf("cmdArgs = %s; want get __gotest__:key1", got)
+	}
+
+	cmd = redis.NewStringCmd(ctx, "set", "__gotest__:key1", strings.Repeat("v", 100))
+	if got := cmdArgs(cmd, 20); got != "set __gotest__:key1 ..." {
+		t.Errorf("cmdArgs truncated = %s; want set __gotest__:key1 ...", got)
+	}
+
+	if got := cmdKey(redis.NewStatusCmd(ctx, "ping")); got != "" {
+		t.Errorf("cmdKey ping = %s; want empty", got)
+	}
+
+	cmd.SetErr(redis.Nil)
+	if got := cmdErr(cmd); got != nil {
+		t.Errorf("cmdErr redis.Nil = %v; want nil", got)
+	}
+	if got := cmdStatus(cmd.Err()); got != "miss" {
+		t.Errorf("cmdStatus redis.Nil = %s; want miss", got)
+	}
+	if got := cmdStatus(errors.New("err")); got != "error" {
+		t.Errorf("cmdStatus = %s; want error", got)
+	}
+}
+
+func TestTracingHookErrorTags(t *testing.T) {
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	hook := newTracingHook(config.Redis{Name: "redis1"}, "127.0.0.1:6379")
+	for _, err := range []error{nil, redis.Nil, errors.New("ERR wrong type")} {
+		cmd := redis.NewStringCmd(ctx, "get", "__gotest__:key1")
+		cctx, _ := hook.BeforeProcess(ctx, cmd)
+		cmd.SetErr(err)
+		hook.AfterProcess(cctx, cmd)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("finished spans = %d; want 3", len(spans))
+	}
+
+	if spans[0].Tag("error") != nil || spans[0].Tag("redis.miss") != nil {
+		t.Errorf("span tags = %v; want no error and miss", spans[0].Tags())
+	}
+	if spans[1].Tag("error") != nil || spans[1].Tag("redis.miss") != true {
+		t.Errorf("span tags = %v; want miss", spans[1].Tags())
+	}
+	if spans[2].Tag("error") != true || spans[2].Tag("redis.error") != "ERR wrong type" {
+		t.Errorf("span tags = %v; want error", spans[2].Tags())
+	}
+	if spans[2].Tag("db.instance") != "redis1" || spans[2].Tag("peer.address") != "127.0.0.1:6379" {
+		t.Errorf("span tags = %v; want db.instance and peer.address", spans[2].Tags())
+	}
+}
+
+// testLogger records the level and the fields of the entries logged with fields.
+type testLogger struct {
+	log.Logger
+	entries []map[string]interface{}
+}
+
+func (l *testLogger) record(level string, msg string, keysAndValues ...interface{}) {
+	entry := map[string]interface{}{"level": level, "msg": msg}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		entry[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func (l *testLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.record("info", msg, keysAndValues...)
+}
+
+func (l *testLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.record("warn", msg, keysAndValues...)
+}
+
+func (l *testLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.record("error", msg, keysAndValues...)
+}
+
+func TestLoggingHookArgs(t *testing.T) {
+	logger := &testLogger{}
+	ctx := log.ContextWithLogger(context.Background(), logger)
+
+	process := func(hook loggingHook, err error) {
+		cmd := redis.NewStatusCmd(ctx, "set", "__gotest__:key1", "secret value")
+		cctx, _ := hook.BeforeProcess(ctx, cmd)
+		cmd.SetErr(err)
+		hook.AfterProcess(cctx, cmd)
+	}
+
+	process(loggingHook{name: "redis1", slowThreshold: time.Hour}, nil)
+	process(loggingHook{name: "redis1", slowThreshold: time.Hour}, errors.New("ERR wrong type"))
+	process(loggingHook{name: "redis1", slowThreshold: time.Nanosecond}, nil)
+
+	if len(logger.entries) != 3 {
+		t.Fatalf("entries = %d; want 3", len(logger.entries))
+	}
+	for i, want := range []struct {
+		level string
+		args  bool
+	}{{"info", false}, {"error", true}, {"warn", true}} {
+		entry := logger.entries[i]
+		if entry["level"] != want.level || entry["key"] != "__gotest__:key1" {
+			t.Errorf("entry %d = %v; want level %s and key", i, entry, want.level)
+		}
+		if _, ok := entry["args"]; ok != want.args {
+			t.Errorf("entry %d = %v; want args %v", i, entry, want.args)
+		}
+	}
+}
+
+func TestHooksProcess(t *testing.T) {
+	rdb, mr := newTestClient(t)
+	rdb.AddHook(newTracingHook(config.Redis{Name: "mini"}, mr.Addr()))
+	rdb.AddHook(loggingHook{name: "mini", slowThreshold: time.Hour})
+
+	tracer := mocktracer.New()
+	logger := &testLogger{}
+	ctx := opentracing.ContextWithSpan(context.Background(), tracer.StartSpan("parent"))
+	ctx = log.ContextWithLogger(ctx, logger)
+
+	rdb.Set(ctx, "__gotest__:key1", "secret value", time.Minute)
+	rdb.Get(ctx, "__gotest__:key2")
+	if err := rdb.LPush(ctx, "__gotest__:key1", "v").Err(); err == nil {
+		t.Fatal("LPush on a string = nil; want error")
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("finished spans = %d; want 3", len(spans))
+	}
+	if spans[0].Tag("error") != nil || spans[1].Tag("redis.miss") != true || spans[2].Tag("error") != true {
+		t.Errorf("span tags = %v, %v, %v", spans[0].Tags(), spans[1].Tags(), spans[2].Tags())
+	}
+	if spans[2].Tag("peer.address") != mr.Addr() {
+		t.Errorf("span peer.address = %v; want %s", spans[2].Tag("peer.address"), mr.Addr())
+	}
+
+	if len(logger.entries) != 3 {
+		t.Fatalf("entries = %d; want 3", len(logger.entries))
+	}
+	for i, want := range []struct {
+		level string
+		args  bool
+	}{{"info", false}, {"info", false}, {"error", true}} {
+		entry := logger.entries[i]
+		if entry["level"] != want.level {
+			t.Errorf("entry %d = %v; want level %s", i, entry, want.level)
+		}
+		if _, ok := entry["args"]; ok != want.args {
+			t.Errorf("entry %d = %v; want args %v", i, entry, want.args)
+		}
+	}
+}
@@ -3,16 +3,24 @@ package redis
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/WiFeng/go-sky/config"
 	"github.com/WiFeng/go-sky/log"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
 )
 
 var (
 	testService = "testService"
+	testAddr    = "127.0.0.1:6379"
+
+	// testRedis is whether the redis of testAddr is available. The tests of
+	// it are skipped without it, the others use miniredis, see newTestClient.
+	testRedis bool
 )
 
 func TestMain(m *testing.M) {
@@ -33,12 +41,41 @@ func TestMain(m *testing.M) {
 		fmt.Println("Error:", err)
 	}
 
-	Init(context.Background(), testService, redisConf)
+	if conn, err := net.DialTimeout("tcp", testAddr, time.Second); err != nil {
+		fmt.Println("Skip the tests of the redis:", err)
+	} else {
+		conn.Close()
+		testRedis = true
+		Init(context.Background(), testService, redisConf)
+	}
 
 	os.Exit(m.Run())
 }
 
+func skipWithoutRedis(t *testing.T) {
+	t.Helper()
+	if !testRedis {
+		t.Skip("redis " + testAddr + " is not available")
+	}
+}
+
+// newTestClient returns a client of a miniredis server, which is closed
+// when the test finishes.
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb, mr
+}
+
 func TestSet(t *testing.T) {
+	skipWithoutRedis(t)
 	var ctx = context.Background()
 	redisCli, err := GetInstance(ctx, "redis")
 	if err != nil {
@@ -54,6 +91,7 @@ func TestSet(t *testing.T) {
 }
 
 func TestGet(t *testing.T) {
+	skipWithoutRedis(t)
 	var ctx = context.Background()
 	redisCli, err := GetInstance(ctx, "redis")
 	if err != nil {
@@ -69,3 +107,26 @@ func TestGet(t *testing.T) {
 		t.Errorf("redis.Get = %s; want val2", got)
 	}
 }
+
+func TestNewClient(t *testing.T) {
+	rdb, err := newClient(config.Redis{Name: "cluster", Mode: ModeCluster, Addrs: []string{"127.0.0.1:7000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rdb.(*redis.ClusterClient); !ok {
+		t.Errorf("newClient cluster = %T; want *redis.ClusterClient", rdb)
+	}
+	rdb.Close()
+
+	if _, err = newClient(config.Redis{Name: "sentinel", Mode: ModeSentinel}); err != ErrMasterNameNotFound {
+		t.Errorf("newClient sentinel = %v; want %v", err, ErrMasterNameNotFound)
+	}
+
+	if _, err = newClient(config.Redis{Name: "unknown", Mode: "unknown"}); err != ErrUnknownMode {
+		t.Errorf("newClient unknown = %v; want %v", err, ErrUnknownMode)
+	}
+
+	if _, err = newClient(config.Redis{Name: "tls", TLS: true, Mode: ModeStandalone, TLSCAFile: "not_found.pem"}); err == nil {
+		t.Error("newClient tls = nil; want error")
+	}
+}
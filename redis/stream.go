@@ -0,0 +1,494 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WiFeng/go-sky/helper"
+	"github.com/WiFeng/go-sky/log"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+// StreamTraceField is the field of the stream messages which carries the trace
+// context of the producer. It's removed from the messages passed to the handler.
+const StreamTraceField = "_sky_trace"
+
+var (
+	// ErrStreamValues ...
+	ErrStreamValues = errors.New("redis stream values must be map[string]interface{}")
+	// ErrHandlerPanic ...
+	ErrHandlerPanic = errors.New("redis handler panic error")
+	// ErrStreamConsumer ...
+	ErrStreamConsumer = errors.New("redis stream consumer name is empty")
+)
+
+// StreamAdd adds a message to the stream with XADD, carrying the trace context of ctx.
+// The values of a must be map[string]interface{}.
+func StreamAdd(ctx context.Context, name string, a *redis.XAddArgs) (string, error) {
+	rdb, err := GetUniversalInstance(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	values, ok := a.Values.(map[string]interface{})
+	if !ok {
+		return "", ErrStreamValues
+	}
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		carrier := opentracing.TextMapCarrier{}
+		if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err == nil {
+			query := url.Values{}
+			for k, v := range carrier {
+				query.Set(k, v)
+			}
+
+			copied := make(map[string]interface{}, len(values)+1)
+			for k, v := range values {
+				copied[k] = v
+			}
+			copied[StreamTraceField] = query.Encode()
+
+			args := *a
+			args.Values = copied
+			a = &args
+		}
+	}
+
+	return rdb.XAdd(ctx, a).Result()
+}
+
+// StreamHandler handles the messages read by RunStreamConsumerGroup.
+// A message is acknowledged only when Handle returns nil.
+type StreamHandler interface {
+	Handle(ctx context.Context, msg redis.XMessage) error
+}
+
+// StreamHandlerFunc ...
+type StreamHandlerFunc func(ctx context.Context, msg redis.XMessage) error
+
+// Handle ...
+func (f StreamHandlerFunc) Handle(ctx context.Context, msg redis.XMessage) error {
+	return f(ctx, msg)
+}
+
+// StreamOption ...
+type StreamOption func(*streamOptions)
+
+type streamOptions struct {
+	consumer      string
+	startID       string
+	batchSize     int64
+	block         time.Duration
+	claimMinIdle  time.Duration
+	claimInterval time.Duration
+	retryBackoff  time.Duration
+	maxDeliveries int64
+}
+
+// StreamConsumer sets the name of the consumer in the group, the hostname by default.
+// It should be stable across restarts, e.g. the pod name of a StatefulSet, otherwise
+// every restart leaves a consumer in the group, see XINFO CONSUMERS and XGROUP DELCONSUMER.
+// The consumers of the same group must have different names.
+func StreamConsumer(consumer string) StreamOption {
+	return func(o *streamOptions) {
+		o.consumer = consumer
+	}
+}
+
+// StreamStartID sets the id from which the group reads if it's created, `$` by default
+// which means the new messages only, and `0` means all of the messages in the stream.
+func StreamStartID(id string) StreamOption {
+	return func(o *streamOptions) {
+		o.startID = id
+	}
+}
+
+// StreamBatchSize sets how many messages are read at most at once, 10 by default.
+func StreamBatchSize(n int64) StreamOption {
+	return func(o *streamOptions) {
+		o.batchSize = n
+	}
+}
+
+// StreamBlock sets how long XREADGROUP blocks if there is no message, 2s by default.
+// The runner waits for it at most to stop.
+func StreamBlock(d time.Duration) StreamOption {
+	return func(o *streamOptions) {
+		o.block = d
+	}
+}
+
+// StreamClaim sets how long a message is pending before it's reclaimed,
+// and how often to reclaim them, which are 1m and 30s by default.
+// The failed messages are handled again after they are reclaimed.
+func StreamClaim(minIdle time.Duration, interval time.Duration) StreamOption {
+	return func(o *streamOptions) {
+		o.claimMinIdle = minIdle
+		o.claimInterval = interval
+	}
+}
+
+// StreamMaxDeliveries limits how many times a message is delivered to the handler.
+// A reclaimed message which has been delivered n times is logged and acknowledged
+// without being handled, so that a poison message doesn't fail forever.
+// It's 0 by default, the failed message is handled again until it succeeds.
+func StreamMaxDeliveries(n int64) StreamOption {
+	return func(o *streamOptions) {
+		o.maxDeliveries = n
+	}
+}
+
+// RunStreamConsumerGroup joins the consumer group of the stream on the redis instance
+// `name`, creating it if not exists, and handles the messages until ctx is done,
+// SIGINT/SIGTERM is received or the process runs its defer functions. The messages
+// pending longer than the claim min idle in the group, e.g. of a crashed consumer,
+// are reclaimed with XAUTOCLAIM, or XPENDING and XCLAIM before redis 6.2.
+func RunStreamConsumerGroup(ctx context.Context, name string, stream string, group string, handler StreamHandler, opt ...StreamOption) error {
+	rdb, err := GetUniversalInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	options := streamOptions{
+		consumer:      hostname,
+		startID:       "$",
+		batchSize:     10,
+		block:         2 * time.Second,
+		claimMinIdle:  time.Minute,
+		claimInterval: 30 * time.Second,
+		retryBackoff:  time.Second,
+	}
+	for _, o := range opt {
+		o(&options)
+	}
+	if options.consumer == "" {
+		log.Errorw(ctx, "redis stream consumer error", "name", name, "stream", stream, "group", group, "err", ErrStreamConsumer)
+		return ErrStreamConsumer
+	}
+
+	err = rdb.XGroupCreateMkStream(ctx, stream, group, options.startID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Errorw(ctx, "redis stream group create error", "name", name, "stream", stream, "group", group, "err", err)
+		return err
+	}
+
+	ctx, stop := helper.RunUntilShutdown(ctx, func(sig os.Signal) {
+		log.Infow(ctx, "redis stream consumer group prepare shutdown", "name", name, "stream", stream, "group", group, "signal", sig.String())
+	})
+	defer stop()
+
+	c := &streamConsumer{
+		rdb:           rdb,
+		name:          name,
+		stream:        stream,
+		group:         group,
+		handler:       handler,
+		streamOptions: options,
+	}
+
+	log.Infow(ctx, "redis stream consumer group start", "name", name, "stream", stream, "group", group, "consumer", options.consumer)
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= options.claimInterval {
+			lastClaim = time.Now()
+			c.reclaim(ctx)
+		}
+
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: options.consumer,
+			Streams:  []string{stream, ">"},
+			Count:    options.batchSize,
+			Block:    options.block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Errorw(ctx, "redis stream read error", "name", name, "stream", stream, "group", group, "err", err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(options.retryBackoff):
+			}
+			continue
+		}
+
+		for _, s := range streams {
+			c.handle(s.Messages)
+		}
+	}
+
+	log.Infow(context.Background(), "redis stream consumer group exit", "name", name, "stream", stream, "group", group)
+	return nil
+}
+
+type streamConsumer struct {
+	streamOptions
+	rdb     redis.UniversalClient
+	name    string
+	stream  string
+	group   string
+	handler StreamHandler
+
+	noAutoClaim bool
+}
+
+// reclaim claims the messages pending longer than the min idle, and handles them.
+func (c *streamConsumer) reclaim(ctx context.Context) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		var msgs []redis.XMessage
+		var err error
+		if c.noAutoClaim {
+			msgs, err = c.claim(ctx)
+			start = "0-0"
+		} else {
+			msgs, start, err = c.autoClaim(ctx, start)
+			if err != nil && strings.HasPrefix(err.Error(), "ERR unknown command") {
+				c.noAutoClaim = true
+				continue
+			}
+		}
+		if err != nil {
+			log.Errorw(ctx, "redis stream claim error", "name", c.name, "stream", c.stream, "group", c.group, "err", err)
+			return
+		}
+
+		if len(msgs) > 0 {
+			log.Infow(ctx, "redis stream claim messages", "name", c.name, "stream", c.stream, "group", c.group, "count", len(msgs))
+			c.handle(c.dropPoison(ctx, msgs))
+		}
+
+		// XPENDING can not page from the last id before redis 6.2,
+		// so only one batch is claimed in a round.
+		if start == "0-0" {
+			return
+		}
+	}
+}
+
+// autoClaim claims a batch of the messages from start with XAUTOCLAIM, which
+// is not supported by the client yet. It returns the start of the next batch,
+// which is 0-0 if there is no more.
+func (c *streamConsumer) autoClaim(ctx context.Context, start string) ([]redis.XMessage, string, error) {
+	reply, err := c.rdb.Do(ctx, "XAUTOCLAIM", c.stream, c.group, c.consumer,
+		c.claimMinIdle.Milliseconds(), start, "COUNT", c.batchSize).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	return parseAutoClaim(reply)
+}
+
+func parseAutoClaim(reply interface{}) ([]redis.XMessage, string, error) {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) < 2 {
+		return nil, "", fmt.Errorf("redis stream: unexpected XAUTOCLAIM reply %v", reply)
+	}
+
+	next, ok := items[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("redis stream: unexpected XAUTOCLAIM reply %v", reply)
+	}
+
+	entries, _ := items[1].([]interface{})
+	msgs := make([]redis.XMessage, 0, len(entries))
+	for _, entry := range entries {
+		// The deleted messages are nil, or have nil fields before redis 7.
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields) != 2 {
+			continue
+		}
+		id, _ := fields[0].(string)
+		kvs, ok := fields[1].([]interface{})
+		if id == "" || !ok {
+			continue
+		}
+
+		values := make(map[string]interface{}, len(kvs)/2)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			if k, ok := kvs[i].(string); ok {
+				values[k] = kvs[i+1]
+			}
+		}
+		msgs = append(msgs, redis.XMessage{ID: id, Values: values})
+	}
+	return msgs, next, nil
+}
+
+// claim claims a batch of the messages with XPENDING and XCLAIM.
+func (c *streamConsumer) claim(ctx context.Context) ([]redis.XMessage, error) {
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  "-",
+		End:    "+",
+		Count:  c.batchSize,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if p.Idle >= c.claimMinIdle {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return c.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		MinIdle:  c.claimMinIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// dropPoison acknowledges the claimed messages delivered more than maxDeliveries
+// times, including the claim, and returns the others.
+func (c *streamConsumer) dropPoison(ctx context.Context, msgs []redis.XMessage) []redis.XMessage {
+	if c.maxDeliveries <= 0 {
+		return msgs
+	}
+
+	// The claimed messages are pending on this consumer, in the order of their ids.
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Start:    msgs[0].ID,
+		End:      msgs[len(msgs)-1].ID,
+		Count:    int64(len(msgs)),
+		Consumer: c.consumer,
+	}).Result()
+	if err != nil {
+		log.Errorw(ctx, "redis stream pending error", "name", c.name, "stream", c.stream, "group", c.group, "err", err)
+		return msgs
+	}
+
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	kept := msgs[:0:0]
+	for _, msg := range msgs {
+		if deliveries[msg.ID] <= c.maxDeliveries {
+			kept = append(kept, msg)
+			continue
+		}
+
+		log.Errorw(ctx, "redis stream handler give up", "name", c.name, "stream", c.stream, "group", c.group,
+			"id", msg.ID, "attempts", deliveries[msg.ID]-1)
+		if err := c.rdb.XAck(context.Background(), c.stream, c.group, msg.ID).Err(); err != nil {
+			log.Errorw(ctx, "redis stream ack error", "name", c.name, "stream", c.stream,
+				"group", c.group, "id", msg.ID, "err", err)
+		}
+	}
+	return kept
+}
+
+// handle handles the messages one by one, and acknowledges the handled ones.
+// The failed ones are left pending until they are reclaimed.
+func (c *streamConsumer) handle(msgs []redis.XMessage) {
+	for _, msg := range msgs {
+		if err := c.handleOnce(msg); err != nil {
+			continue
+		}
+
+		// The ack is not interrupted by shutdown.
+		if err := c.rdb.XAck(context.Background(), c.stream, c.group, msg.ID).Err(); err != nil {
+			log.Errorw(context.Background(), "redis stream ack error", "name", c.name, "stream", c.stream,
+				"group", c.group, "id", msg.ID, "err", err)
+		}
+	}
+}
+
+func (c *streamConsumer) handleOnce(msg redis.XMessage) (err error) {
+	var spanOpts = []opentracing.StartSpanOption{
+		opentracing.Tag{Key: "message.stream", Value: c.stream},
+		opentracing.Tag{Key: "message.id", Value: msg.ID},
+		opentracing.Tag{Key: "consumer.group", Value: c.group},
+		opentracing.Tag{Key: string(opentracingext.Component), Value: "redis"},
+		opentracingext.SpanKindConsumer,
+	}
+	if spanCtx, ok := extractStreamTrace(msg); ok {
+		spanOpts = append(spanOpts, opentracing.FollowsFrom(spanCtx))
+	}
+	if _, ok := msg.Values[StreamTraceField]; ok {
+		values := make(map[string]interface{}, len(msg.Values))
+		for k, v := range msg.Values {
+			if k != StreamTraceField {
+				values[k] = v
+			}
+		}
+		msg.Values = values
+	}
+
+	// The message in flight is not interrupted by shutdown,
+	// so the handler gets a context that is independent of the runner.
+	var ctx = context.Background()
+	var span = opentracing.GlobalTracer().StartSpan("redis.StreamConsumerGroup.Handle", spanOpts...)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = log.BuildLogger(ctx)
+
+	defer func(begin time.Time) {
+		if panicErr := recover(); panicErr != nil {
+			log.Errorw(ctx, "redis stream handler panic error", "err", panicErr)
+			err = ErrHandlerPanic
+		}
+
+		if err != nil {
+			opentracingext.Error.Set(span, true)
+			span.SetTag("message.error", err.Error())
+			log.Errorw(ctx, "redis stream handler error", "name", c.name, "stream", c.stream,
+				"group", c.group, "id", msg.ID, "err", err)
+		}
+
+		log.Debugw(ctx, fmt.Sprintf("consume %s/%s", c.stream, msg.ID), "name", c.name, "group", c.group,
+			"request_time", fmt.Sprintf("%.3f", float32(time.Since(begin).Microseconds())/1000))
+		span.Finish()
+	}(time.Now())
+
+	err = c.handler.Handle(ctx, msg)
+	return
+}
+
+// extractStreamTrace returns the trace context carried by the message.
+func extractStreamTrace(msg redis.XMessage) (opentracing.SpanContext, bool) {
+	raw, ok := msg.Values[StreamTraceField].(string)
+	if !ok {
+		return nil, false
+	}
+
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return nil, false
+	}
+
+	carrier := opentracing.TextMapCarrier{}
+	for k := range query {
+		carrier[k] = query.Get(k)
+	}
+
+	spanCtx, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		return nil, false
+	}
+	return spanCtx, true
+}
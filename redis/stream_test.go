@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestParseAutoClaim(t *testing.T) {
+	reply := []interface{}{
+		"1-2",
+		[]interface{}{
+			[]interface{}{"1-0", []interface{}{"k1", "v1", "k2", "v2"}},
+			[]interface{}{"1-1", nil},
+			nil,
+		},
+		[]interface{}{},
+	}
+
+	msgs, next, err := parseAutoClaim(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "1-2" {
+		t.Errorf("next = %q; want 1-2", next)
+	}
+
+	want := []redis.XMessage{{ID: "1-0", Values: map[string]interface{}{"k1": "v1", "k2": "v2"}}}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("msgs = %+v; want %+v", msgs, want)
+	}
+
+	if _, _, err = parseAutoClaim("OK"); err == nil {
+		t.Error("want error for unexpected reply")
+	}
+}
+
+func TestIsPattern(t *testing.T) {
+	for channel, want := range map[string]bool{
+		"news":      false,
+		"news.*":    true,
+		"news.?":    true,
+		"news.[ab]": true,
+	} {
+		if got := isPattern(channel); got != want {
+			t.Errorf("isPattern(%q) = %v; want %v", channel, got, want)
+		}
+	}
+}
+
+func TestStreamMaxDeliveries(t *testing.T) {
+	rdb, _ := newTestClient(t)
+
+	var ctx = context.Background()
+	var err error
+	if err = rdb.XGroupCreateMkStream(ctx, "stream1", "group1", "$").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err = rdb.XAdd(ctx, &redis.XAddArgs{Stream: "stream1", Values: map[string]interface{}{"k": "v"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	c := &streamConsumer{
+		rdb:    rdb,
+		name:   "mini",
+		stream: "stream1",
+		group:  "group1",
+		handler: StreamHandlerFunc(func(ctx context.Context, msg redis.XMessage) error {
+			calls++
+			return errors.New("failed")
+		}),
+		streamOptions: streamOptions{consumer: "consumer1", batchSize: 10, maxDeliveries: 2},
+	}
+
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: "group1", Consumer: "consumer1", Streams: []string{"stream1", ">"}, Count: 10, Block: -1,
+	}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handle(streams[0].Messages)
+
+	// The message is reclaimed and handled again, which is the second delivery.
+	c.reclaim(ctx)
+	if calls != 2 {
+		t.Fatalf("handler is called %d times; want 2", calls)
+	}
+
+	// The third delivery is acknowledged without being handled.
+	c.reclaim(ctx)
+	if calls != 2 {
+		t.Errorf("handler is called %d times; want 2", calls)
+	}
+	if n, err := rdb.XPending(ctx, "stream1", "group1").Result(); err != nil || n.Count != 0 {
+		t.Errorf("pending = %+v, %v; want none", n, err)
+	}
+}
@@ -26,6 +26,7 @@ var (
 	globalConfigDir   string
 	globalConfigFile  string
 	globalEnvironment string
+	globalArgs        []string
 
 	globalConfig config.Config
 )
@@ -83,8 +84,9 @@ func initFlag() (*string, *string, error) {
 		environment = fs.String("env", "", "Runing environment")
 	)
 
-	fs.Usage = usageFor(fs, os.Args[0]+" [flags]")
+	fs.Usage = usageFor(fs, os.Args[0]+" [flags] [command]")
 	err := fs.Parse(os.Args[1:])
+	globalArgs = fs.Args()
 
 	return configDir, environment, err
 }
@@ -104,6 +106,11 @@ func usageFor(fs *flag.FlagSet, short string) func() {
 	}
 }
 
+// Args returns the arguments remaining after the flags, e.g. a subcommand of the service.
+func Args() []string {
+	return globalArgs
+}
+
 // LoadConfig ...
 func LoadConfig(name string, conf interface{}) (err error) {
 	var confFile string